@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+)
+
+// Config describes a run generating several packages, such as the core
+// protocol along with the extensions built on it.  The other flags
+// apply to every package.
+type Config struct {
+	Packages []*job `json:"packages"`
+
+	// ImportRoot is the import path of the config's directory, which
+	// the packages without an import are given theirs under, after
+	// their output directory.
+	ImportRoot string `json:"import_root,omitempty"`
+
+	dir string // of the config file, which paths are relative to
+}
+
+// runtimeImport is the import path of the wl runtime, which is where
+// the wl package is generated to and which every other package
+// imports as it is.
+const runtimeImport = "github.com/dkolbly/wl"
+
+// readConfig decodes a config file, resolving the paths in it and
+// filling in the default package settings.
+func readConfig(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{dir: filepath.Dir(file)}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	for _, j := range cfg.Packages {
+		j.Source, j.Output, j.Manifest = cfg.rel(j.Source), cfg.rel(j.Output), cfg.rel(j.Manifest)
+		for i, mirror := range j.Mirrors {
+			j.Mirrors[i] = cfg.rel(mirror)
+		}
+		for i, file := range j.Append {
+			j.Append[i] = cfg.rel(file)
+		}
+		j.Annotations = cfg.rel(j.Annotations)
+		j.Snippets = cfg.rel(j.Snippets)
+		if j.Package == "" {
+			j.Package = "wl"
+		}
+		if j.Import == "" && j.Package == "wl" {
+			j.Import = runtimeImport
+		}
+	}
+	return cfg, nil
+}
+
+// rel resolves a path in the config against its directory.
+func (cfg *Config) rel(path string) string {
+	if path == "" || filepath.IsAbs(path) || strings.Contains(path, "://") || strings.HasPrefix(path, "pkg-config:") {
+		return path
+	}
+	return filepath.Join(cfg.dir, path)
+}
+
+// importOf returns the import path under the config's ImportRoot of
+// the package generated to output, or "" if there is no root or output
+// is not in the config's directory.
+func (cfg *Config) importOf(output string) string {
+	if cfg.ImportRoot == "" {
+		return ""
+	}
+	base, err1 := filepath.Abs(cfg.dir)
+	dir, err2 := filepath.Abs(filepath.Dir(output))
+	if err1 != nil || err2 != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(base, dir)
+	switch {
+	case err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)):
+		return ""
+	case rel == ".":
+		return cfg.ImportRoot
+	}
+	return path.Join(cfg.ImportRoot, filepath.ToSlash(rel))
+}
+
+// runBatch generates every package in the config file.  All protocols
+// are read first, so that interfaces one protocol uses from another
+// resolve to the other package's Go types.
+func runBatch(file string) {
+	cfg, err := readConfig(file)
+	if err != nil {
+		log.Fatalf("%s: %s", file, err)
+	}
+	if len(cfg.Packages) == 0 {
+		log.Fatalf("%s: no packages to generate", file)
+	}
+	if *checkRepro {
+		log.Fatal("-check-reproducible does not support -config")
+	}
+	if lock := readLock(lockPath(file)); lock != nil {
+		lock.pinJobs(lockPath(file), cfg.Packages)
+	}
+	for _, j := range cfg.Packages {
+		if j.Source == "" || (j.Output == "" && *outputTemplate == "") {
+			log.Fatalf("%s: every package needs a source and an output", file)
+		}
+	}
+	prefetch(cfg.Packages)
+	for _, j := range cfg.Packages {
+		j.load()
+	}
+	runPackages(file, cfg.Packages, cfg.rel, cfg.importOf)
+}
+
+// prefetch downloads the remote sources of jobs, -fetch-jobs at a
+// time, for load to find already fetched, rather than have load fetch
+// them one after another.
+func prefetch(jobs []*job) {
+	if *fetchJobs < 1 {
+		log.Fatal("-fetch-jobs must be at least 1")
+	}
+	next := make(chan *job)
+	var wg sync.WaitGroup
+	for w := 0; w < *fetchJobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				if j.pin != nil {
+					j.pin.fetch(j.Mirrors)
+				} else {
+					fetchAny(j.Source, j.Mirrors)
+				}
+			}
+		}()
+	}
+	for _, j := range jobs {
+		if isRemote(j.Source) {
+			next <- j
+		}
+	}
+	close(next)
+	wg.Wait()
+}
+
+// runPackages generates loaded jobs together, from the config file or
+// checkout named what.  rel resolves the outputs named by
+// -output-template, and importOf, if not nil, gives the packages
+// without an import theirs from their output.
+func runPackages(what string, jobs []*job, rel func(string) string, importOf func(output string) string) {
+	names := generator.NewNameTable()
+	base := baseOptions()
+	var inputs []sourceProtocol
+	outputs := make(map[string]string)
+	for _, j := range jobs {
+		if j.Output == "" {
+			j.Output = rel(j.templateOutput())
+		}
+		if prev, ok := outputs[j.Output]; ok {
+			log.Fatalf("%s: %s and %s are both generated into %s", what, prev, j.Source, j.Output)
+		}
+		outputs[j.Output] = j.Source
+		if j.Import == "" && importOf != nil {
+			j.Import = importOf(j.Output)
+		}
+		inputs = append(inputs, j.input(base))
+		names.Add(j.prot, generator.Options{Package: j.Package, Unstable: j.Unstable}, j.Import)
+	}
+
+	if *skipUnchanged && skip(jobs) {
+		return
+	}
+
+	if reportErrors(append(checkLayout(jobs), checkReferences(jobs)...)) > 0 {
+		log.Fatalf("%s cannot be generated", what)
+	}
+	if reportErrors(preflight(inputs)) > 0 {
+		log.Fatalf("%s cannot be generated", what)
+	}
+
+	generateAll(jobs, names)
+}
+
+// checkLayout reports packages that cannot make up one module: two
+// with different names in a directory, or with one import path but
+// different directories.  Jobs without an output are left out.  It
+// also reports a wl package imported other than as the runtime, since
+// the generated code and umbrella packages import the runtime by its
+// own path and would get two packages named wl.
+func checkLayout(jobs []*job) []Diagnostic {
+	var diags []Diagnostic
+	dirs := make(map[string]*job)    // by directory
+	imports := make(map[string]*job) // by import path
+	for _, j := range jobs {
+		if j.Package == "wl" && j.Import != "" && j.Import != runtimeImport {
+			diags = append(diags, Diagnostic{
+				File:     j.Source,
+				Severity: severityError,
+				Rule:     "wl-import",
+				Message: fmt.Sprintf("package wl is imported as %s, but the other packages import the wl runtime as %s",
+					j.Import, runtimeImport),
+			})
+		}
+		if j.Output == "" {
+			continue
+		}
+		dir := filepath.Dir(j.Output)
+		if prev, ok := dirs[dir]; ok && prev.Package != j.Package {
+			diags = append(diags, Diagnostic{
+				File:     j.Source,
+				Severity: severityError,
+				Rule:     "package-dir",
+				Message: fmt.Sprintf("package %s is generated into %s, which already holds package %s from %s",
+					j.Package, dir, prev.Package, prev.Source),
+			})
+		} else if !ok {
+			dirs[dir] = j
+		}
+		if j.Import == "" {
+			continue
+		}
+		if prev, ok := imports[j.Import]; ok && filepath.Dir(prev.Output) != dir {
+			diags = append(diags, Diagnostic{
+				File:     j.Source,
+				Severity: severityError,
+				Rule:     "package-import",
+				Message: fmt.Sprintf("import %s is given to both %s and %s, in different directories",
+					j.Import, prev.Source, j.Source),
+			})
+		} else if !ok {
+			imports[j.Import] = j
+		}
+	}
+	return diags
+}
+
+// checkReferences reports args referring to an interface of another
+// package of the run that cannot be imported: it has no import path,
+// or has the name of the package referring to it.
+func checkReferences(jobs []*job) []Diagnostic {
+	var diags []Diagnostic
+	defined := make(map[string]*job)
+	for _, j := range jobs {
+		for _, iface := range j.prot.Interfaces {
+			defined[iface.Name] = j
+		}
+	}
+	for _, j := range jobs {
+		reported := make(map[*job]bool)
+		check := func(args []Arg) {
+			for _, arg := range args {
+				other, ok := defined[arg.Interface]
+				if !ok || reported[other] || filepath.Dir(other.Output) == filepath.Dir(j.Output) {
+					continue
+				}
+				var problem string
+				switch {
+				case other.Import == "":
+					problem = "which has no import; give it one, or the config an import_root"
+				case other.Package == j.Package:
+					problem = "which has the same name, so cannot be imported by it"
+				default:
+					continue
+				}
+				reported[other] = true
+				diags = append(diags, Diagnostic{
+					File:     j.Source,
+					Line:     arg.Line,
+					Severity: severityError,
+					Rule:     "package-reference",
+					Message: fmt.Sprintf("package %s refers to %s of package %s from %s, %s",
+						j.Package, arg.Interface, other.Package, other.Source, problem),
+				})
+			}
+		}
+		for _, iface := range j.prot.Interfaces {
+			for _, req := range iface.Requests {
+				if !req.Excluded {
+					check(req.Args)
+				}
+			}
+			for _, ev := range iface.Events {
+				if !ev.Excluded {
+					check(ev.Args)
+				}
+			}
+		}
+	}
+	return diags
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+)
+
+// The changelog tells the users of a generated package what a
+// regeneration did to its API: the exported symbols added and removed,
+// and those whose signature or type changed.
+
+// An apiSymbol is an exported symbol of a generated file.  Sig is
+// shown, and Key compared, which for functions leaves out parameter
+// names, since renaming a parameter breaks nobody.
+type apiSymbol struct {
+	Sig, Key string
+}
+
+// An api maps the exported symbols of a Go file, as in Surface.Damage
+// or const SurfaceErrorInvalidScale, to their signatures.
+type api map[string]apiSymbol
+
+// apiOf reads the exported API of generated Go source.
+func apiOf(name string, src []byte) (api, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	show := func(node ast.Node) string {
+		var b bytes.Buffer
+		printer.Fprint(&b, fset, node)
+		return b.String()
+	}
+	a := make(api)
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			name := d.Name.Name
+			if d.Recv != nil {
+				recv := d.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if id, ok := recv.(*ast.Ident); !ok || !id.IsExported() {
+					continue
+				}
+				name = show(recv) + "." + name
+			}
+			a["func "+name] = apiSymbol{show(d.Type), funcKey(show, d.Type)}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if !s.Name.IsExported() {
+						continue
+					}
+					st, ok := s.Type.(*ast.StructType)
+					if !ok {
+						sig := show(s.Type)
+						a["type "+s.Name.Name] = apiSymbol{sig, sig}
+						continue
+					}
+					a["type "+s.Name.Name] = apiSymbol{"struct", "struct"}
+					for _, field := range st.Fields.List {
+						for _, n := range field.Names {
+							if n.IsExported() {
+								sig := show(field.Type)
+								a["field "+s.Name.Name+"."+n.Name] = apiSymbol{sig, sig}
+							}
+						}
+					}
+				case *ast.ValueSpec:
+					kind := "var "
+					if d.Tok == token.CONST {
+						kind = "const "
+					}
+					for n, name := range s.Names {
+						if !name.IsExported() {
+							continue
+						}
+						sig := ""
+						if s.Type != nil {
+							sig = show(s.Type)
+						}
+						if d.Tok == token.CONST && n < len(s.Values) {
+							sig = strings.TrimSpace(sig + " = " + show(s.Values[n]))
+						}
+						a[kind+name.Name] = apiSymbol{sig, sig}
+					}
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+// funcKey is the signature of a function less its parameter names.
+func funcKey(show func(ast.Node) string, fn *ast.FuncType) string {
+	types := func(fields *ast.FieldList) string {
+		if fields == nil {
+			return ""
+		}
+		var ts []string
+		for _, f := range fields.List {
+			for n := 0; n < len(f.Names) || n == 0; n++ {
+				ts = append(ts, show(f.Type))
+			}
+		}
+		return strings.Join(ts, ", ")
+	}
+	return "func(" + types(fn.Params) + ") (" + types(fn.Results) + ")"
+}
+
+// writeChangelog writes what changed from old to new, under a heading
+// for the package, in Markdown.  It writes nothing if nothing changed.
+func writeChangelog(w io.Writer, heading string, old, new api) {
+	var added, removed, changed []string
+	for name, sym := range new {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			added = append(added, fmt.Sprintf("`%s` %s", name, quoteSig(sym.Sig)))
+		case prev.Key != sym.Key:
+			changed = append(changed, fmt.Sprintf("`%s`: %s → %s", name, quoteSig(prev.Sig), quoteSig(sym.Sig)))
+		}
+	}
+	for name, sym := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, fmt.Sprintf("`%s` %s", name, quoteSig(sym.Sig)))
+		}
+	}
+	if len(added)+len(removed)+len(changed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "## %s\n", heading)
+	for _, section := range []struct {
+		title string
+		items []string
+	}{{"Removed", removed}, {"Changed", changed}, {"Added", added}} {
+		if len(section.items) == 0 {
+			continue
+		}
+		sort.Strings(section.items)
+		fmt.Fprintf(w, "\n### %s\n\n", section.title)
+		for _, item := range section.items {
+			fmt.Fprintf(w, " * %s\n", item)
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func quoteSig(sig string) string {
+	if sig == "" {
+		return ""
+	}
+	return "`" + strings.Join(strings.Fields(sig), " ") + "`"
+}
+
+// noteChanges records, for -changelog, the API of the job's generated
+// Go file and that of the output it replaces, if any.
+func (j *job) noteChanges() {
+	if *changelog == "" || j.err != nil || !emitKinds()["client"] {
+		return
+	}
+	var err error
+	if j.api, err = apiOf(j.Output, j.files[0].Data); err != nil {
+		log.Fatal(err)
+	}
+	j.oldAPI = api{}
+	if old, err := ioutil.ReadFile(j.Output); err == nil {
+		if j.oldAPI, err = apiOf(j.Output, old); err != nil {
+			log.Printf("%s: cannot read the API it had, so listing everything as added: %s", j.Output, err)
+			j.oldAPI = api{}
+		}
+	} else if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+}
+
+// writeChangelogFile writes the -changelog of the jobs generated.
+func writeChangelogFile(file string, jobs []*job) {
+	var b bytes.Buffer
+	for _, j := range jobs {
+		if j.api != nil {
+			writeChangelog(&b, fmt.Sprintf("package %s (%s)", j.Package, j.Output), j.oldAPI, j.api)
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("No changes to the generated API.\n")
+	}
+	if err := ioutil.WriteFile(file, b.Bytes(), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runChangelog implements "wl-scanner changelog old new", which
+// generates both protocols, each XML or IR, as the flags before it say,
+// and prints what changed in the generated API.
+func runChangelog(args []string) {
+	if len(args) != 2 {
+		log.Fatal("usage: wl-scanner [flags] changelog old.xml new.xml")
+	}
+	apis := make([]api, 2)
+	for n, src := range args {
+		opts := baseOptions()
+		opts.Package, opts.Unstable = *pkgName, *unstable
+		opts.Source, opts.Emitters = src, nil
+		files, err := generator.Generate(readProtocol(src), opts)
+		if err != nil {
+			log.Fatalf("%s: %s", src, err)
+		}
+		if apis[n], err = apiOf(src, files[0].Data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	writeChangelog(&b, fmt.Sprintf("package %s: %s → %s", *pkgName, args[0], args[1]), apis[0], apis[1])
+	if b.Len() == 0 {
+		b.WriteString("No changes to the generated API.\n")
+	}
+	os.Stdout.Write(b.Bytes())
+}
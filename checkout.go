@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The directories of a wayland-protocols checkout, each holding one
+// directory per protocol.
+var stabilities = []string{"stable", "staging", "unstable"}
+
+// isCheckout reports whether src is a directory, which -source takes
+// to be a wayland-protocols checkout.
+func isCheckout(src string) bool {
+	dir, err := filePath(src)
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir()
+}
+
+// pathVersion finds the version in the name of a protocol file, as in
+// xdg-decoration-unstable-v1.xml or fractional-scale-v1.xml.
+var pathVersion = regexp.MustCompile(`-(v[0-9]+)$`)
+
+// runCheckout generates every protocol in a wayland-protocols checkout
+// that -protocols selects, each into a directory of -output named
+// after its XML file.
+func runCheckout(dir string) {
+	dir, _ = filePath(dir)
+	if *output == "" {
+		log.Fatal("-output must name the directory to generate a checkout into")
+	}
+	if *outputTemplate != "" || *checkRepro || *annotations != "" {
+		log.Fatal("-output-template, -check-reproducible and -annotations do not support a checkout")
+	}
+	base := *importBase
+	if base == "" {
+		base = modulePath(*output)
+		if base == "" {
+			log.Fatalf("-import is needed for the import path of %s, which has no go.mod", *output)
+		}
+	}
+
+	var jobs []*job
+	found := false
+	for _, stability := range stabilities {
+		protocols, err := ioutil.ReadDir(filepath.Join(dir, stability))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		found = true
+		for _, p := range protocols {
+			if !p.IsDir() || !selected(stability+"/"+p.Name()) {
+				continue
+			}
+			files, err := filepath.Glob(filepath.Join(dir, stability, p.Name(), "*.xml"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, file := range files {
+				jobs = append(jobs, checkoutJob(file, base))
+			}
+		}
+	}
+	if !found {
+		log.Fatalf("%s is not a wayland-protocols checkout: it has none of %s", dir, strings.Join(stabilities, ", "))
+	}
+	if len(jobs) == 0 {
+		log.Fatalf("-protocols %s selects nothing in %s", *selectProtocols, dir)
+	}
+	if !*quiet {
+		log.Printf("%s: %d protocols", dir, len(jobs))
+	}
+	runPackages(dir, jobs, func(p string) string { return p }, nil)
+}
+
+// checkoutJob loads the protocol in file, naming its package after
+// the interfaces, and its directory and version after the file.
+func checkoutJob(file, base string) *job {
+	stem := strings.TrimSuffix(filepath.Base(file), ".xml")
+	j := &job{Source: file}
+	j.load()
+	j.Package, j.Unstable = packageOf(j.prot)
+	if m := pathVersion.FindStringSubmatch(stem); m != nil && j.Unstable != "" && j.Unstable != m[1] {
+		warnf("layout-version", file, j.prot.Line, "named version %s, but its interfaces end in _%s", m[1], j.Unstable)
+	}
+	j.Output = filepath.Join(*output, stem, j.prot.Name+".go")
+	j.Import = base + "/" + stem
+	return j
+}
+
+// selected reports whether -protocols selects the protocol directory
+// name, such as unstable/xdg-decoration.  A pattern without a slash
+// matches the protocol's name in any directory.
+func selected(name string) bool {
+	if *selectProtocols == "" {
+		return true
+	}
+	for _, pattern := range strings.Split(*selectProtocols, ",") {
+		subject := name
+		if !strings.Contains(pattern, "/") {
+			subject = path.Base(name)
+		}
+		ok, err := path.Match(pattern, subject)
+		if err != nil {
+			log.Fatalf("-protocols: %s", err)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// runConfig implements "wl-scanner config", of which there is only
+// "config check" so far.
+func runConfig(args []string) {
+	if len(args) != 2 || args[0] != "check" {
+		log.Fatal("usage: wl-scanner config check wl-scanner.json")
+	}
+	file := args[1]
+	cfg, err := readConfig(file)
+	if err != nil {
+		log.Fatalf("%s: %s", file, err)
+	}
+	if reportDiagnostics(checkConfig(file, cfg)) > 0 {
+		log.Fatalf("%s has errors", file)
+	}
+	if !*quiet {
+		log.Printf("%s: %d packages OK", file, len(cfg.Packages))
+	}
+}
+
+var unstableSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// checkConfig finds the mistakes in a config that can be found without
+// fetching or generating anything, all at once rather than one per
+// batch run.
+func checkConfig(file string, cfg *Config) []Diagnostic {
+	var diags []Diagnostic
+	errorf := func(rule string, n int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Severity: severityError,
+			Rule:     rule,
+			Message:  fmt.Sprintf("package %d: ", n+1) + fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(cfg.Packages) == 0 {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Severity: severityError,
+			Rule:     "no-packages",
+			Message:  "no packages to generate",
+		})
+	}
+
+	outputs := make(map[string]int)
+	for n, j := range cfg.Packages {
+		checkSource := func(what, src string) {
+			switch {
+			case strings.HasPrefix(src, "gitlab:"):
+				if _, err := gitlabURL(src); err != nil {
+					errorf("config-source", n, "%s %s", what, err)
+				}
+			case strings.HasPrefix(src, "file:"), strings.HasPrefix(src, "pkg-config:"):
+				if file, err := filePath(src); err != nil {
+					errorf("config-source", n, "%s %s", what, err)
+				} else if _, err := os.Stat(file); err != nil {
+					errorf("config-source", n, "%s", err)
+				}
+			case strings.Contains(src, "://"):
+				u, err := url.Parse(src)
+				switch {
+				case err != nil:
+					errorf("config-source", n, "%s %s: %s", what, src, err)
+				case u.Scheme != "http" && u.Scheme != "https":
+					errorf("config-source", n, "%s %s is not an http, https or gitlab URL", what, src)
+				case u.Host == "":
+					errorf("config-source", n, "%s %s has no host", what, src)
+				}
+			default:
+				if _, err := os.Stat(src); err != nil {
+					errorf("config-source", n, "%s", err)
+				}
+			}
+		}
+		if j.Source == "" {
+			errorf("config-source", n, "has no source")
+		} else {
+			checkSource("source", j.Source)
+		}
+		for _, mirror := range j.Mirrors {
+			checkSource("mirror", mirror)
+		}
+
+		for _, file := range j.Append {
+			if _, err := os.Stat(file); err != nil {
+				errorf("config-append", n, "%s", err)
+			}
+		}
+		if j.Snippets != "" {
+			if snippets, err := readSnippets(j.Snippets); err != nil {
+				errorf("config-snippets", n, "%s", err)
+			} else {
+				var names []string
+				for name := range snippets {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if _, err := template.New(name).Parse(snippets[name]); err != nil {
+						errorf("config-snippets", n, "%s", err)
+					}
+				}
+			}
+		}
+		if j.Annotations != "" {
+			if text, err := ioutil.ReadFile(j.Annotations); err != nil {
+				errorf("config-annotations", n, "%s", err)
+			} else if _, err := protocol.ReadAnnotations(j.Annotations, text); err != nil {
+				errorf("config-annotations", n, "%s", err)
+			}
+		}
+
+		if !token.IsIdentifier(j.Package) {
+			errorf("config-package", n, "pkg %q is not a valid Go package name", j.Package)
+		}
+		if j.Unstable != "" && !unstableSuffix.MatchString(j.Unstable) {
+			errorf("config-unstable", n, "unstable %q is not a version suffix like v1", j.Unstable)
+		}
+		if j.Module != "" && j.Package != "wl" && *runtimeVersion == "" {
+			errorf("config-module", n, "module %s needs -runtime-version", j.Module)
+		}
+
+		if j.Output == "" {
+			if *outputTemplate == "" {
+				errorf("config-output", n, "has no output, and there is no -output-template")
+			}
+			continue // named after the protocol, which is not read here
+		}
+		if prev, ok := outputs[j.Output]; ok {
+			errorf("config-output", n, "output %s is also the output of package %d", j.Output, prev+1)
+		} else {
+			outputs[j.Output] = n
+		}
+	}
+
+	if root := cfg.ImportRoot; root != "" && (strings.ContainsAny(root, " \\:") || strings.HasPrefix(root, "/") || strings.HasSuffix(root, "/")) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Severity: severityError,
+			Rule:     "config-import-root",
+			Message:  fmt.Sprintf("import_root %q is not an import path", root),
+		})
+	}
+	layout := make([]*job, len(cfg.Packages))
+	for n, j := range cfg.Packages {
+		j := *j
+		if j.Import == "" {
+			j.Import = cfg.importOf(j.Output)
+		}
+		layout[n] = &j
+	}
+	return append(diags, checkLayout(layout)...)
+}
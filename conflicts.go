@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+)
+
+// sourceProtocol is a decoded protocol together with the file it came
+// from, for reporting, and the options it is generated with.
+type sourceProtocol struct {
+	File     string
+	Protocol *Protocol
+	Options  generator.Options
+}
+
+// runtimeNames are declared by the wl runtime package itself, and so
+// cannot be used for generated symbols in package wl.
+var runtimeNames = []string{
+	"BaseProxy",
+	"Context",
+	"Dispatcher",
+	"Event",
+	"Proxy",
+	"ProxyId",
+}
+
+// symbolTable tracks where each generated Go identifier in one scope
+// came from, so collisions can be reported against both origins.
+type symbolTable struct {
+	file    string
+	scope   string
+	defined map[string]symbolOrigin
+	diags   *[]Diagnostic
+}
+
+type symbolOrigin struct {
+	what string
+	line int
+}
+
+func newSymbolTable(file, scope string, diags *[]Diagnostic) *symbolTable {
+	return &symbolTable{
+		file:    file,
+		scope:   scope,
+		defined: make(map[string]symbolOrigin),
+		diags:   diags,
+	}
+}
+
+// add records symbol as generated for what, reporting it if it is
+// already generated for something else, and returns whether it is not.
+func (t *symbolTable) add(symbol, what string, line int) bool {
+	prev, ok := t.defined[symbol]
+	if !ok {
+		t.defined[symbol] = symbolOrigin{what, line}
+		return true
+	}
+	if prev.what == what {
+		// the same wayland name defined twice, reported by checkConflicts
+		return true
+	}
+	msg := fmt.Sprintf("%s generates %s%s, which is already generated for %s",
+		what, t.scope, symbol, prev.what)
+	if prev.line > 0 {
+		msg += fmt.Sprintf(" on line %d", prev.line)
+	}
+	*t.diags = append(*t.diags, Diagnostic{
+		File:     t.file,
+		Line:     line,
+		Severity: severityError,
+		Rule:     "symbol-collision",
+		Message:  msg,
+	})
+	return false
+}
+
+// checkConflicts reports interfaces defined more than once across all
+// the inputs, duplicate message and enum names within an interface,
+// and any two definitions that would generate the same Go identifier.
+// All problems are reported together rather than stopping at the first.
+func checkConflicts(inputs []sourceProtocol) []Diagnostic {
+	var diags []Diagnostic
+	errorf := func(rule, file string, line int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Line:     line,
+			Severity: severityError,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	type location struct {
+		file string
+		line int
+	}
+	ifaces := make(map[string]location)
+
+	for _, in := range inputs {
+		for _, iface := range in.Protocol.Interfaces {
+			if prev, ok := ifaces[iface.Name]; ok {
+				errorf("duplicate-interface", in.File, iface.Line, "interface %s is already defined at %s:%d",
+					iface.Name, prev.file, prev.line)
+			} else {
+				ifaces[iface.Name] = location{in.File, iface.Line}
+			}
+
+			seen := make(map[string]int)
+			for _, req := range iface.Requests {
+				if prev, ok := seen[req.Name]; ok {
+					errorf("duplicate-request", in.File, req.Line, "request %s.%s is already defined on line %d",
+						iface.Name, req.Name, prev)
+				} else {
+					seen[req.Name] = req.Line
+				}
+			}
+			seen = make(map[string]int)
+			for _, ev := range iface.Events {
+				if prev, ok := seen[ev.Name]; ok {
+					errorf("duplicate-event", in.File, ev.Line, "event %s.%s is already defined on line %d",
+						iface.Name, ev.Name, prev)
+				} else {
+					seen[ev.Name] = ev.Line
+				}
+			}
+			seen = make(map[string]int)
+			for _, enum := range iface.Enums {
+				if prev, ok := seen[enum.Name]; ok {
+					errorf("duplicate-enum", in.File, enum.Line, "enum %s.%s is already defined on line %d",
+						iface.Name, enum.Name, prev)
+				} else {
+					seen[enum.Name] = enum.Line
+				}
+			}
+		}
+
+		checkSymbols(in, &diags)
+	}
+	return diags
+}
+
+// checkSymbols reports the Go identifiers the generator would declare
+// twice for a protocol, package level or per type, along with those
+// that package wl would declare over the runtime's own.
+func checkSymbols(in sourceProtocol, diags *[]Diagnostic) {
+	pkg := newSymbolTable(in.File, "", diags)
+	if in.Options.Package == "wl" {
+		for _, name := range runtimeNames {
+			pkg.add(name, "the wl runtime", 0)
+		}
+	}
+	scopes := map[string]*symbolTable{"": pkg}
+	collided := make(map[string]bool) // types, whose members are not checked
+	seen := make(map[[3]string]bool)  // a message defined twice generates all it does twice
+	for _, id := range generator.Identifiers(in.Protocol, in.Options) {
+		key := [3]string{id.Scope, id.Name, id.What}
+		if collided[id.Scope] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		t := scopes[id.Scope]
+		if t == nil {
+			t = newSymbolTable(in.File, id.Scope+".", diags)
+			scopes[id.Scope] = t
+		}
+		if !t.add(id.Name, id.What, id.Line) && id.Scope == "" {
+			collided[id.Name] = true
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a protocol file, tied to the line
+// of the element it concerns.
+type Diagnostic struct {
+	File      string `json:"file"`
+	Line      int    `json:"line,omitempty"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Rule      string `json:"rule,omitempty"`      // what kind of problem, e.g. "since-version"
+	Interface string `json:"interface,omitempty"` // the interface the line is in, if any
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.File, d.Severity, d.Message)
+}
+
+// ANSI escapes for colored diagnostics.
+const (
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiGreen  = "\x1b[32m"
+	ansiReset  = "\x1b[0m"
+)
+
+// colored reports whether diagnostics go to a terminal, and so are
+// worth coloring.  NO_COLOR and TERM=dumb turn it off.
+var colored = func() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}()
+
+// sourceLines caches the lines of the files diagnostics quote.
+var sourceLines = struct {
+	sync.Mutex
+	files map[string][]string
+}{files: make(map[string][]string)}
+
+// sourceLine returns line n of file, or false if it cannot be read,
+// as when the file was a URL.
+func sourceLine(file string, n int) (string, bool) {
+	sourceLines.Lock()
+	defer sourceLines.Unlock()
+	lines, ok := sourceLines.files[file]
+	if !ok {
+		if data, err := ioutil.ReadFile(file); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		sourceLines.files[file] = lines
+	}
+	if n < 1 || n > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// pretty renders d for a terminal: colored, and followed by the line
+// it concerns with the element there underlined.
+func (d Diagnostic) pretty() string {
+	color := ansiYellow
+	if d.Severity == severityError {
+		color = ansiRed
+	}
+	var b strings.Builder
+	b.WriteString(ansiBold + d.File)
+	if d.Line > 0 {
+		fmt.Fprintf(&b, ":%d", d.Line)
+	}
+	fmt.Fprintf(&b, ":%s %s%s:%s %s", ansiReset, color, d.Severity, ansiReset, d.Message)
+
+	line, ok := sourceLine(d.File, d.Line)
+	if !ok || strings.TrimSpace(line) == "" {
+		return b.String()
+	}
+	line = strings.Replace(line, "\t", "    ", -1)
+	start := len(line) - len(strings.TrimLeft(line, " "))
+	end := len(line)
+	if i := strings.IndexByte(line[start:], '>'); i >= 0 {
+		end = start + i + 1
+	}
+	gutter := fmt.Sprintf("%5d | ", d.Line)
+	fmt.Fprintf(&b, "\n%s%s\n%*s| %s%s%s%s", gutter, line, len(gutter)-2, "",
+		strings.Repeat(" ", start), ansiGreen, "^"+strings.Repeat("~", end-start-1), ansiReset)
+	return b.String()
+}
+
+// printDiagnostic logs d, in color with its context on a terminal.
+// Only errors are logged with -q, warnings being errors with -Werror.
+func printDiagnostic(d Diagnostic) {
+	if *quiet && !*werror && d.Severity != severityError {
+		return
+	}
+	if *diagFormat == "json" {
+		if d.Interface == "" {
+			d.Interface = interfaceAt(d.File, d.Line)
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false) // messages quote XML elements
+		if err := enc.Encode(d); err != nil {
+			log.Fatal(err)
+		}
+		log.Print(buf.String())
+		return
+	}
+	if colored {
+		log.Print(d.pretty())
+	} else {
+		log.Print(d)
+	}
+}
+
+// protocols are the decoded inputs by file, for telling which
+// interface a diagnostic concerns.
+var protocols = struct {
+	sync.Mutex
+	byFile map[string]*Protocol
+}{byFile: make(map[string]*Protocol)}
+
+func rememberProtocol(file string, prot *Protocol) {
+	protocols.Lock()
+	defer protocols.Unlock()
+	protocols.byFile[file] = prot
+}
+
+// interfaceAt returns the name of the interface of file that line is
+// in, or "" if it is in none or the file was not decoded.
+func interfaceAt(file string, line int) string {
+	protocols.Lock()
+	defer protocols.Unlock()
+	prot := protocols.byFile[file]
+	if prot == nil || line <= 0 {
+		return ""
+	}
+	name := ""
+	for _, iface := range prot.Interfaces {
+		if iface.Line > 0 && iface.Line <= line {
+			name = iface.Name
+		}
+	}
+	return name
+}
+
+// warnings collects the non-fatal problems found while generating, for
+// the summary printed at the end of the run.
+var warnings []Diagnostic
+
+// warnf records a warning about a line of an input being generated.
+func warnf(rule, file string, line int, format string, args ...interface{}) {
+	warnings = append(warnings, Diagnostic{
+		File:     file,
+		Line:     line,
+		Severity: severityWarning,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// reportErrors logs the errors among diags right away, keeps the
+// warnings for the summary, and returns the number of errors.
+func reportErrors(diags []Diagnostic) int {
+	errors := 0
+	for _, d := range diags {
+		if d.Severity == severityError {
+			printDiagnostic(d)
+			errors++
+		} else {
+			warnings = append(warnings, d)
+		}
+	}
+	return errors
+}
+
+// summarizeWarnings logs the warnings collected during the run.
+func summarizeWarnings() {
+	if len(warnings) == 0 || *quiet && !*werror {
+		return
+	}
+	if *diagFormat == "json" {
+		for _, w := range warnings {
+			printDiagnostic(w)
+		}
+		return
+	}
+	if len(warnings) == 1 {
+		log.Print("1 warning:")
+	} else {
+		log.Printf("%d warnings:", len(warnings))
+	}
+	for _, w := range warnings {
+		printDiagnostic(w)
+	}
+}
+
+// reportDiagnostics logs every diagnostic and returns the number of errors.
+func reportDiagnostics(diags []Diagnostic) int {
+	errors := 0
+	for _, d := range diags {
+		printDiagnostic(d)
+		if d.Severity == severityError {
+			errors++
+		}
+	}
+	return errors
+}
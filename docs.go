@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// runDocs implements "wl-scanner docs", rendering human readable
+// documentation for a protocol from the same model the generator uses.
+func runDocs(args []string) {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	src := fs.String("source", "", "Where to get the XML from")
+	format := fs.String("format", "markdown", "Output format (markdown, html, dot)")
+	dest := fs.String("output", "", "Where to put the documentation (a file, default stdout, or a directory for html and -pages)")
+	pages := fs.Bool("pages", false, "Write Markdown as a directory of cross-linked pages, one per interface")
+	fs.Parse(args)
+	if *pages && *format != "markdown" && *format != "md" {
+		log.Fatalf("-pages is for markdown, not %s", *format)
+	}
+
+	prot := readProtocol(*src)
+
+	switch *format {
+	case "markdown", "md":
+		if !*pages {
+			writeMarkdownDocs(prot, *dest)
+			break
+		}
+		if *dest == "" {
+			log.Fatal("-pages needs an -output directory")
+		}
+		writeMarkdownPages(prot, *dest)
+	case "html":
+		if *dest == "" {
+			log.Fatal("html docs need an -output directory")
+		}
+		writeHTMLDocs(prot, *dest)
+	case "dot":
+		writeDotGraph(prot, *dest)
+	default:
+		log.Fatalf("unknown docs format %q", *format)
+	}
+}
+
+func writeMarkdownDocs(prot *Protocol, dest string) {
+	var out io.Writer = os.Stdout
+	if dest != "" {
+		f, err := os.Create(dest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := renderMarkdownDocs(out, prot); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func renderMarkdownDocs(out io.Writer, prot *Protocol) error {
+	tmpl := template.Must(template.New("MarkdownDocs").Funcs(docFuncs(prot)).Parse(markdownDocsTemplate))
+	return tmpl.Execute(out, prot)
+}
+
+// docFuncs returns the template functions for documenting prot.
+// Interfaces defined in prot are linked to, others are just named.
+func docFuncs(prot *Protocol) template.FuncMap {
+	defined := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		defined[iface.Name] = true
+	}
+
+	return template.FuncMap{
+		"text":   protocol.Text,
+		"cell":   docCell,
+		"anchor": docAnchor,
+		"argType": func(arg Arg) string {
+			t := "`" + arg.Type + "`"
+			if arg.Interface != "" {
+				if defined[arg.Interface] {
+					t += fmt.Sprintf(" [%s](#%s)", arg.Interface, docAnchor(arg.Interface))
+				} else {
+					t += " " + arg.Interface
+				}
+			}
+			if arg.Enum != "" {
+				t += " enum `" + arg.Enum + "`"
+			}
+			if arg.AllowNull {
+				t += " (nullable)"
+			}
+			return t
+		},
+	}
+}
+
+// docCell makes text safe to use in a markdown table cell.
+func docCell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.Replace(text, "|", "\\|", -1)
+}
+
+// docAnchor returns the anchor GitHub-flavoured markdown gives a heading.
+func docAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+var markdownDocsTemplate = `# {{.Name}}
+{{- with .Description.Summary}}
+
+_{{.}}_
+{{- end}}
+{{- with text .Description.Text}}
+
+{{.}}
+{{- end}}
+
+| Interface | Version | Summary |
+|-----------|---------|---------|
+{{- range .Interfaces}}
+| [{{.Name}}](#{{anchor .Name}}) | {{.Version}} | {{cell .Description.Summary}} |
+{{- end}}
+{{- range .Interfaces}}
+{{- $iface := .Name}}
+
+## {{.Name}}
+{{- with .Description.Summary}}
+
+_{{.}}_
+{{- end}}
+
+Version {{.Version}}.
+{{- with text .Description.Text}}
+
+{{.}}
+{{- end}}
+{{- if .Requests}}
+
+### Requests
+{{- range $opcode, $req := .Requests}}
+
+#### {{$iface}}.{{.Name}}
+{{- with .Description.Summary}}
+
+_{{.}}_
+{{- end}}
+
+Opcode {{$opcode}}{{if gt .Since 1}}, since version {{.Since}}{{end}}{{if eq .Type "destructor"}}, destructor{{end}}.
+{{- with text .Description.Text}}
+
+{{.}}
+{{- end}}
+{{- if .Args}}
+
+| Argument | Type | Summary |
+|----------|------|---------|
+{{- range .Args}}
+| {{.Name}} | {{argType .}} | {{cell .Summary}} |
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- if .Events}}
+
+### Events
+{{- range $opcode, $ev := .Events}}
+
+#### {{$iface}}.{{.Name}}
+{{- with .Description.Summary}}
+
+_{{.}}_
+{{- end}}
+
+Opcode {{$opcode}}{{if gt .Since 1}}, since version {{.Since}}{{end}}.
+{{- with text .Description.Text}}
+
+{{.}}
+{{- end}}
+{{- if .Args}}
+
+| Argument | Type | Summary |
+|----------|------|---------|
+{{- range .Args}}
+| {{.Name}} | {{argType .}} | {{cell .Summary}} |
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- if .Enums}}
+
+### Enums
+{{- range .Enums}}
+
+#### {{$iface}}.{{.Name}}
+{{- with .Description.Summary}}
+
+_{{.}}_
+{{- end}}
+{{- if or .BitField (gt .Since 1)}}
+
+{{if .BitField}}Bitfield.{{end}}{{if and .BitField (gt .Since 1)}} {{end}}{{if gt .Since 1}}Since version {{.Since}}.{{end}}
+{{- end}}
+{{- with text .Description.Text}}
+
+{{.}}
+{{- end}}
+
+| Entry | Value | Summary |
+|-------|-------|---------|
+{{- range .Entries}}
+| {{.Name}} | {{.Value}} | {{cell .Summary}}{{if gt .Since 1}} (since version {{.Since}}){{end}} |
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+`
+
+// docsFile is the -emit docs emitter, writing the Markdown docs next to
+// the generated package.
+func docsFile(m *generator.Model) ([]generator.File, error) {
+	var buf bytes.Buffer
+	if err := renderMarkdownDocs(&buf, m.Protocol); err != nil {
+		return nil, err
+	}
+	return []generator.File{{Name: m.Protocol.Name + ".md", Data: buf.Bytes()}}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+)
+
+type dotEdge struct {
+	From, To string
+	Create   bool // new_id, rather than an object argument
+	Labels   []string
+}
+
+type dotGraph struct {
+	Name     string
+	Nodes    []string
+	External []string
+	Edges    []*dotEdge
+}
+
+// interfaceGraph works out which interfaces create which (through
+// new_id args) and which take which as object args.
+func interfaceGraph(prot *Protocol) *dotGraph {
+	g := &dotGraph{Name: prot.Name}
+	defined := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		g.Nodes = append(g.Nodes, iface.Name)
+		defined[iface.Name] = true
+	}
+
+	type edgeKey struct {
+		from, to string
+		create   bool
+	}
+	edges := make(map[edgeKey]*dotEdge)
+	add := func(from string, arg Arg, msg string) {
+		if arg.Interface == "" || (arg.Type != "new_id" && arg.Type != "object") {
+			return
+		}
+		key := edgeKey{from, arg.Interface, arg.Type == "new_id"}
+		e, ok := edges[key]
+		if !ok {
+			e = &dotEdge{From: key.from, To: key.to, Create: key.create}
+			edges[key] = e
+			g.Edges = append(g.Edges, e)
+			if !defined[arg.Interface] {
+				defined[arg.Interface] = true
+				g.External = append(g.External, arg.Interface)
+			}
+		}
+		e.Labels = append(e.Labels, msg)
+	}
+
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			for _, arg := range req.Args {
+				add(iface.Name, arg, req.Name)
+			}
+		}
+		for _, ev := range iface.Events {
+			for _, arg := range ev.Args {
+				add(iface.Name, arg, ev.Name+" (event)")
+			}
+		}
+	}
+	return g
+}
+
+func writeDotGraph(prot *Protocol, dest string) {
+	funcs := template.FuncMap{
+		"join": strings.Join,
+	}
+	tmpl := template.Must(template.New("DotGraph").Funcs(funcs).Parse(dotGraphTemplate))
+
+	var out io.Writer = os.Stdout
+	if dest != "" {
+		f, err := os.Create(dest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := tmpl.Execute(out, interfaceGraph(prot)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Solid edges lead to objects the source creates, dashed edges to
+// objects it takes as arguments; interfaces from other protocols are grey.
+var dotGraphTemplate = `digraph "{{.Name}}" {
+	rankdir=LR;
+	node [shape=box, fontname="sans-serif"];
+	edge [fontname="sans-serif", fontsize=10];
+{{- range .Nodes}}
+	"{{.}}";
+{{- end}}
+{{- range .External}}
+	"{{.}}" [style=dashed, color=grey, fontcolor=grey];
+{{- end}}
+{{- range .Edges}}
+	"{{.From}}" -> "{{.To}}" [label="{{join .Labels "\\n"}}"{{if not .Create}}, style=dashed{{end}}];
+{{- end}}
+}
+`
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	_ "embed"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// waylandDTD is the document type definition distributed with wayland
+// as protocol/wayland.dtd.
+//
+//go:embed wayland.dtd
+var waylandDTD string
+
+// dtdElement is the declaration of one element type.  The content
+// model is compiled into a regular expression matched against the
+// names of the children, each followed by a comma.
+type dtdElement struct {
+	Model    string
+	Content  *regexp.Regexp
+	Text     bool
+	Attrs    map[string]bool // name -> required
+	AttrList []string
+}
+
+type dtd map[string]*dtdElement
+
+var (
+	dtdElementDecl = regexp.MustCompile(`<!ELEMENT\s+(\S+)\s+([^>]+)>`)
+	dtdAttlistDecl = regexp.MustCompile(`<!ATTLIST\s+(\S+)\s+(\S+)\s+\S+\s+(#REQUIRED|#IMPLIED)\s*>`)
+	dtdModelToken  = regexp.MustCompile(`#PCDATA|[A-Za-z_][-A-Za-z0-9_.]*|[(),|?*+]`)
+)
+
+// parseDTD understands the subset of DTD syntax used by wayland.dtd:
+// element declarations with PCDATA or element content, and CDATA
+// attributes that are either required or implied.
+func parseDTD(text string) (dtd, error) {
+	d := make(dtd)
+	for _, m := range dtdElementDecl.FindAllStringSubmatch(text, -1) {
+		model := strings.TrimSpace(m[2])
+		el := &dtdElement{Model: model, Attrs: make(map[string]bool)}
+
+		var re strings.Builder
+		re.WriteString("^")
+		for _, tok := range dtdModelToken.FindAllString(model, -1) {
+			switch tok {
+			case "#PCDATA":
+				el.Text = true
+			case "(":
+				re.WriteString("(?:")
+			case ")", "|", "?", "*", "+":
+				re.WriteString(tok)
+			case ",":
+			default:
+				re.WriteString("(?:" + regexp.QuoteMeta(tok) + ",)")
+			}
+		}
+		re.WriteString("$")
+		if el.Text {
+			// mixed content is limited to (#PCDATA) in wayland.dtd
+			re.Reset()
+			re.WriteString("^$")
+		}
+
+		content, err := regexp.Compile(re.String())
+		if err != nil {
+			return nil, fmt.Errorf("bad content model for %s: %s", m[1], err)
+		}
+		el.Content = content
+		d[m[1]] = el
+	}
+
+	for _, m := range dtdAttlistDecl.FindAllStringSubmatch(text, -1) {
+		el, ok := d[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("attributes declared for unknown element %s", m[1])
+		}
+		el.Attrs[m[2]] = m[3] == "#REQUIRED"
+		el.AttrList = append(el.AttrList, m[2])
+	}
+	return d, nil
+}
+
+// validateDTD checks the document in data against the wayland DTD and
+// returns a diagnostic for every violation.
+func validateDTD(file string, data []byte) []Diagnostic {
+	d, err := parseDTD(waylandDTD)
+	if err != nil {
+		panic(err)
+	}
+
+	type frame struct {
+		name     string
+		line     int
+		children []string
+		declared bool
+	}
+
+	var (
+		diags []Diagnostic
+		dec   = xml.NewDecoder(bytes.NewReader(data))
+		lines = protocol.NewLineCounter(data)
+		stack []*frame
+	)
+	errorf := func(rule string, line int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Line:     line,
+			Severity: severityError,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errorf("dtd-syntax", lines.At(off), "%s", err)
+			break
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			line := lines.At(off)
+			name := tok.Name.Local
+			el, ok := d[name]
+
+			if len(stack) == 0 {
+				if name != "protocol" {
+					errorf("dtd-root", line, "root element is <%s>, expected <protocol>", name)
+				}
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, name)
+				if !ok {
+					parent.declared = false
+				}
+			}
+			stack = append(stack, &frame{name: name, line: line, declared: true})
+
+			if !ok {
+				errorf("dtd-undeclared-element", line, "undeclared element <%s>", name)
+				continue
+			}
+			seen := make(map[string]bool)
+			for _, attr := range tok.Attr {
+				seen[attr.Name.Local] = true
+				if _, ok := el.Attrs[attr.Name.Local]; !ok {
+					errorf("dtd-undeclared-attribute", line, "undeclared attribute %q on <%s>", attr.Name.Local, name)
+				}
+			}
+			for _, attr := range el.AttrList {
+				if el.Attrs[attr] && !seen[attr] {
+					errorf("dtd-missing-attribute", line, "<%s> is missing required attribute %q", name, attr)
+				}
+			}
+
+		case xml.CharData:
+			if len(stack) == 0 || len(bytes.TrimSpace(tok)) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			if el, ok := d[top.name]; ok && !el.Text {
+				lead := len(tok) - len(bytes.TrimLeft(tok, " \t\r\n"))
+				errorf("dtd-text", lines.At(off+int64(lead)), "unexpected text in <%s>", top.name)
+			}
+
+		case xml.EndElement:
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			el, ok := d[top.name]
+			if !ok || !top.declared {
+				continue
+			}
+			seq := ""
+			if len(top.children) > 0 {
+				seq = strings.Join(top.children, ",") + ","
+			}
+			if !el.Content.MatchString(seq) {
+				errorf("dtd-content", top.line, "content of <%s> does not match %s", top.name, el.Model)
+			}
+		}
+	}
+	return diags
+}
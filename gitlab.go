@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// gitlabURL turns a gitlab: source, naming a file in a GitLab project
+// at a ref, into the URL of its content in the GitLab repository files
+// API.  For example
+//
+//	gitlab://gitlab.freedesktop.org/wayland/wayland-protocols?path=stable/xdg-shell/xdg-shell.xml&ref=1.32
+//
+// is stable/xdg-shell/xdg-shell.xml as tagged 1.32 in the
+// wayland/wayland-protocols project.  The ref defaults to HEAD, the
+// project's default branch.
+func gitlabURL(src string) (string, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	project := strings.Trim(u.Path, "/")
+	file := u.Query().Get("path")
+	ref := u.Query().Get("ref")
+	switch {
+	case u.Host == "":
+		return "", fmt.Errorf("%s has no host", src)
+	case project == "":
+		return "", fmt.Errorf("%s names no project", src)
+	case file == "":
+		return "", fmt.Errorf("%s has no path of a file in the project", src)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return fmt.Sprintf("https://%s/api/v4/projects/%s/repository/files/%s/raw?ref=%s",
+		u.Host, url.PathEscape(project), url.PathEscape(file), url.QueryEscape(ref)), nil
+}
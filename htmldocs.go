@@ -0,0 +1,193 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// writeHTMLDocs renders prot as a self-contained set of pages in dir:
+// index.html listing the interfaces, and one page per interface with
+// an anchor for every request, event and enum.
+func writeHTMLDocs(prot *Protocol, dir string) {
+	defined := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		defined[iface.Name] = true
+	}
+
+	funcs := template.FuncMap{
+		"paras": func(text string) []string {
+			text = protocol.Text(text)
+			if text == "" {
+				return nil
+			}
+			return strings.Split(text, "\n\n")
+		},
+		"page": func(iface string) string {
+			return iface + ".html"
+		},
+		"defined": func(iface string) bool {
+			return defined[iface]
+		},
+		"enumLink": func(iface, enum string) string {
+			if i := strings.Index(enum, "."); i >= 0 {
+				iface, enum = enum[:i], enum[i+1:]
+			}
+			if !defined[iface] {
+				return ""
+			}
+			return iface + ".html#enum-" + enum
+		},
+		"argsOf": func(iface string, args []Arg) interface{} {
+			return struct {
+				Iface string
+				Args  []Arg
+			}{iface, args}
+		},
+	}
+	tmpl := template.Must(template.New("HTMLDocs").Funcs(funcs).Parse(htmlDocsTemplate))
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		log.Fatal(err)
+	}
+
+	render := func(file, name string, data interface{}) {
+		f, err := os.Create(filepath.Join(dir, file))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err := tmpl.ExecuteTemplate(f, name, data); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	render("index.html", "index", prot)
+	for i := range prot.Interfaces {
+		render(prot.Interfaces[i].Name+".html", "interface", struct {
+			Protocol  *Protocol
+			Interface *Interface
+		}{prot, &prot.Interfaces[i]})
+	}
+}
+
+var htmlDocsTemplate = `
+{{- define "head" -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; color: #222; }
+a { color: #0645ad; text-decoration: none; }
+a:hover { text-decoration: underline; }
+h3 { border-bottom: 1px solid #ccc; }
+h4 { font-family: monospace; font-size: 1.1em; }
+.summary { font-style: italic; }
+.meta { color: #666; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.5em; text-align: left; vertical-align: top; }
+code { background: #f4f4f4; padding: 0 0.2em; }
+</style>
+</head>
+<body>
+{{- end}}
+
+{{- define "description" -}}
+{{- with .Summary}}
+<p class="summary">{{.}}</p>
+{{- end}}
+{{- range paras .Text}}
+<p>{{.}}</p>
+{{- end}}
+{{- end}}
+
+{{- define "args" -}}
+{{- $iface := .Iface}}
+{{- if .Args}}
+<table>
+<tr><th>Argument</th><th>Type</th><th>Summary</th></tr>
+{{- range .Args}}
+<tr>
+<td><code>{{.Name}}</code></td>
+<td><code>{{.Type}}</code>
+{{- with .Interface}} {{if defined .}}<a href="{{page .}}">{{.}}</a>{{else}}{{.}}{{end}}{{end}}
+{{- with .Enum}} enum {{with enumLink $iface .}}<a href="{{.}}">{{end}}<code>{{.}}</code>{{if enumLink $iface .}}</a>{{end}}{{end}}
+{{- if .AllowNull}} (nullable){{end}}</td>
+<td>{{.Summary}}</td>
+</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+
+{{- define "index" -}}
+{{template "head" .Name}}
+<h1>{{.Name}}</h1>
+{{- template "description" .Description}}
+<table>
+<tr><th>Interface</th><th>Version</th><th>Summary</th></tr>
+{{- range .Interfaces}}
+<tr><td><a href="{{page .Name}}">{{.Name}}</a></td><td>{{.Version}}</td><td>{{.Description.Summary}}</td></tr>
+{{- end}}
+</table>
+{{- with .Copyright}}
+<h2>Copyright</h2>
+<pre>{{.}}</pre>
+{{- end}}
+</body>
+</html>
+{{end}}
+
+{{- define "interface" -}}
+{{- $iface := .Interface.Name}}
+{{- template "head" $iface}}
+<p><a href="index.html">{{.Protocol.Name}}</a></p>
+{{- with .Interface}}
+<h1>{{.Name}}</h1>
+<p class="meta">Version {{.Version}}</p>
+{{- template "description" .Description}}
+{{- if .Requests}}
+<h2>Requests</h2>
+{{- range $opcode, $req := .Requests}}
+<h3 id="request-{{.Name}}"><a href="#request-{{.Name}}">{{$iface}}.{{.Name}}</a></h3>
+<p class="meta">Opcode {{$opcode}}{{if gt .Since 1}}, since version {{.Since}}{{end}}{{if eq .Type "destructor"}}, destructor{{end}}</p>
+{{- template "description" .Description}}
+{{- template "args" (argsOf $iface .Args)}}
+{{- end}}
+{{- end}}
+{{- if .Events}}
+<h2>Events</h2>
+{{- range $opcode, $ev := .Events}}
+<h3 id="event-{{.Name}}"><a href="#event-{{.Name}}">{{$iface}}.{{.Name}}</a></h3>
+<p class="meta">Opcode {{$opcode}}{{if gt .Since 1}}, since version {{.Since}}{{end}}</p>
+{{- template "description" .Description}}
+{{- template "args" (argsOf $iface .Args)}}
+{{- end}}
+{{- end}}
+{{- if .Enums}}
+<h2>Enums</h2>
+{{- range .Enums}}
+<h3 id="enum-{{.Name}}"><a href="#enum-{{.Name}}">{{$iface}}.{{.Name}}</a></h3>
+{{- if or .BitField (gt .Since 1)}}
+<p class="meta">{{if .BitField}}Bitfield{{end}}{{if and .BitField (gt .Since 1)}}, s{{else if gt .Since 1}}S{{end}}{{if gt .Since 1}}ince version {{.Since}}{{end}}</p>
+{{- end}}
+{{- template "description" .Description}}
+<table>
+<tr><th>Entry</th><th>Value</th><th>Summary</th></tr>
+{{- range .Entries}}
+<tr><td><code>{{.Name}}</code></td><td>{{.Value}}</td><td>{{.Summary}}{{if gt .Since 1}} (since version {{.Since}}){{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+{{end}}
+`
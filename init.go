@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// wellKnown maps short names to the upstream XML of commonly used
+// protocols, for "wl-scanner init".
+var wellKnown = map[string]string{
+	"xdg-shell":         "stable/xdg-shell/xdg-shell.xml",
+	"viewporter":        "stable/viewporter/viewporter.xml",
+	"presentation-time": "stable/presentation-time/presentation-time.xml",
+	"linux-dmabuf":      "stable/linux-dmabuf/linux-dmabuf-v1.xml",
+	"xdg-decoration":    "unstable/xdg-decoration/xdg-decoration-unstable-v1.xml",
+	"xdg-output":        "unstable/xdg-output/xdg-output-unstable-v1.xml",
+	"fractional-scale":  "staging/fractional-scale/fractional-scale-v1.xml",
+}
+
+const wellKnownBase = "https://gitlab.freedesktop.org/wayland/wayland-protocols/-/raw/main/"
+
+// runInit implements "wl-scanner init", which sets up a project to
+// generate clients for the protocols it is given: it fetches them into
+// protocols/, and writes a config for them and a generate.go running
+// the scanner on it.
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Directory to set up")
+	importPath := fs.String("import", "", "Go import path of the directory (default from its go.mod)")
+	force := fs.Bool("force", false, "Overwrite an existing config and generate.go")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: wl-scanner init [flags] protocol...\n\n")
+		fmt.Fprintf(fs.Output(), "A protocol is a URL, a local file, or one of these names:\n")
+		var names []string
+		for name := range wellKnown {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(fs.Output(), "  %s\n", name)
+		}
+		fmt.Fprintf(fs.Output(), "\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *importPath == "" {
+		*importPath = modulePath(*dir)
+		if *importPath == "" {
+			log.Fatalf("%s has no go.mod to take the import path from; give -import", *dir)
+		}
+	}
+	configFile := filepath.Join(*dir, "wl-scanner.json")
+	generateFile := filepath.Join(*dir, "protocols", "generate.go")
+	if !*force {
+		for _, file := range []string{configFile, generateFile} {
+			if _, err := os.Stat(file); err == nil {
+				log.Fatalf("%s already exists (use -force to overwrite it)", file)
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(*dir, "protocols"), 0777); err != nil {
+		log.Fatal(err)
+	}
+
+	var cfg Config
+	seen := make(map[string]string)
+	for _, arg := range fs.Args() {
+		src := arg
+		if rel, ok := wellKnown[arg]; ok {
+			src = wellKnownBase + rel
+		}
+		file, err := filePath(src)
+		if err != nil {
+			log.Fatal(err)
+		}
+		base := path.Base(filepath.ToSlash(file))
+		if arg == "wayland" || base == "wayland.xml" {
+			log.Fatalf("%s: the core protocol comes with github.com/dkolbly/wl, so need not be generated", arg)
+		}
+		data, err := ioutil.ReadAll(sourceData(src))
+		if err != nil {
+			log.Fatalf("%s: %s", src, err)
+		}
+		prot, err := protocol.Decode(src, data)
+		if err != nil {
+			log.Fatalf("%s: %s", src, err)
+		}
+
+		stem := strings.TrimSuffix(base, ".xml")
+		if prev, ok := seen[base]; ok {
+			log.Fatalf("%s and %s are both %s", prev, arg, base)
+		}
+		seen[base] = arg
+		if err := ioutil.WriteFile(filepath.Join(*dir, "protocols", base), data, 0666); err != nil {
+			log.Fatal(err)
+		}
+
+		pkg, unstable := packageOf(prot)
+		cfg.Packages = append(cfg.Packages, &job{
+			Source:   "protocols/" + base,
+			Output:   stem + "/" + prot.Name + ".go",
+			Package:  pkg,
+			Unstable: unstable,
+			Import:   *importPath + "/" + stem,
+		})
+		if !*quiet {
+			log.Printf("%s: package %s in %s/", arg, pkg, stem)
+		}
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configFile, append(data, '\n'), 0666); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(generateFile, []byte(generateGo), 0666); err != nil {
+		log.Fatal(err)
+	}
+	if !*quiet {
+		log.Printf("wrote %s and %s; run go generate ./protocols", configFile, generateFile)
+	}
+}
+
+var versionSuffix = regexp.MustCompile(`_(v[0-9]+)$`)
+
+// packageOf picks the package name and unstable suffix for a protocol
+// from its interface names, which all share a prefix, and for
+// unstable protocols a version suffix: zxdg_output_manager_v1 makes
+// package zxdg, with unstable v1.
+func packageOf(prot *Protocol) (pkg, unstable string) {
+	if len(prot.Interfaces) == 0 {
+		return strings.Replace(prot.Name, "-", "_", -1), ""
+	}
+	first := prot.Interfaces[0].Name
+	pkg = first
+	if i := strings.IndexByte(first, '_'); i > 0 {
+		pkg = first[:i]
+	}
+	if m := versionSuffix.FindStringSubmatch(first); m != nil {
+		unstable = m[1]
+		for _, iface := range prot.Interfaces {
+			if !strings.HasSuffix(iface.Name, "_"+unstable) {
+				unstable = ""
+				break
+			}
+		}
+	}
+	return pkg, unstable
+}
+
+// modulePath returns the module path in the go.mod of dir, or "".
+func modulePath(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+const generateGo = `// Package protocols holds the wayland protocol XML that the client
+// packages of this module are generated from.  Edit ../wl-scanner.json
+// to change what is generated, and run go generate here to regenerate.
+package protocols
+
+//go:generate wl-scanner config check ../wl-scanner.json
+//go:generate wl-scanner -config ../wl-scanner.json
+`
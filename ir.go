@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// runIR implements "wl-scanner ir", writing the parsed model as JSON
+// so that other tools can inspect or patch it before it is fed back
+// in as a -source.
+func runIR(args []string) {
+	fs := flag.NewFlagSet("ir", flag.ExitOnError)
+	src := fs.String("source", "", "Where to get the XML from")
+	dest := fs.String("output", "", "Where to put the JSON (default stdout)")
+	fs.Parse(args)
+
+	prot := readProtocol(*src)
+
+	data, err := protocol.MarshalIR(prot)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *dest == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := ioutil.WriteFile(*dest, data, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// irFile is the -emit ir emitter, writing the model as JSON next to
+// the generated package.
+func irFile(m *generator.Model) ([]generator.File, error) {
+	data, err := protocol.MarshalIR(m.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	return []generator.File{{Name: m.Protocol.Name + ".json", Data: data}}, nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+var wlArgTypes = map[string]bool{
+	"int":    true,
+	"uint":   true,
+	"fixed":  true,
+	"string": true,
+	"object": true,
+	"new_id": true,
+	"array":  true,
+	"fd":     true,
+}
+
+// runLint implements "wl-scanner lint file.xml...", reporting
+// semantic problems in protocol files without generating anything.
+func runLint(files []string) {
+	if len(files) == 0 {
+		log.Fatal("usage: wl-scanner lint file.xml...")
+	}
+
+	var (
+		diags  []Diagnostic
+		inputs []sourceProtocol
+	)
+	opts := baseOptions()
+	opts.Package, opts.Unstable = *pkgName, *unstable
+	for _, file := range files {
+		prot, found := lintFile(file)
+		diags = append(diags, found...)
+		if prot != nil {
+			inputs = append(inputs, sourceProtocol{file, prot, opts})
+		}
+	}
+	diags = append(diags, checkConflicts(inputs)...)
+
+	known := knownNamesOf(inputs...)
+	for _, in := range inputs {
+		l := &linter{file: in.File}
+		l.references(in.Protocol, known)
+		diags = append(diags, l.diags...)
+	}
+
+	if reportDiagnostics(diags) > 0 {
+		os.Exit(1)
+	}
+}
+
+// lintFile checks a single protocol file, returning the decoded
+// protocol (if it could be decoded) for checks spanning all inputs.
+func lintFile(file string) (*Protocol, []Diagnostic) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, []Diagnostic{{File: file, Severity: severityError, Rule: "read", Message: err.Error()}}
+	}
+
+	prot, err := protocol.Parse(bytes.NewReader(data))
+	if err != nil {
+		d := Diagnostic{File: file, Severity: severityError, Rule: "syntax", Message: err.Error()}
+		var syntax *xml.SyntaxError
+		if errors.As(err, &syntax) {
+			d.Line = syntax.Line
+		}
+		return nil, []Diagnostic{d}
+	}
+	rememberProtocol(file, prot)
+	l := &linter{file: file, diags: validateDTD(file, data)}
+	l.protocol(prot)
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		return l.diags[i].Line < l.diags[j].Line
+	})
+	return prot, l.diags
+}
+
+// preflight runs the checks whose failure would otherwise produce
+// generated code that does not compile or misrepresents the protocol.
+// The inputs are generated together, so may refer to each other.
+func preflight(inputs []sourceProtocol) []Diagnostic {
+	diags := checkConflicts(inputs)
+
+	known := knownNamesOf(inputs...)
+	for _, in := range inputs {
+		prot := in.Protocol
+		l := &linter{file: in.File}
+		l.references(prot, known)
+		for i := range prot.Interfaces {
+			iface := &prot.Interfaces[i]
+			l.versions(iface)
+			for j := range iface.Enums {
+				l.enum(iface, &iface.Enums[j])
+			}
+		}
+		diags = append(diags, l.diags...)
+	}
+	return diags
+}
+
+// knownNames are the interfaces and enums that args may refer to.
+type knownNames struct {
+	interfaces map[string]bool
+	enums      map[string]bool // "interface.enum"
+	inherited  map[string]bool // interfaces from package wl, enums unknown
+}
+
+// knownNamesOf collects the interfaces and enums defined in the inputs,
+// plus the core interfaces from package wl when checking any other
+// protocol.
+func knownNamesOf(inputs ...sourceProtocol) *knownNames {
+	known := &knownNames{
+		interfaces: make(map[string]bool),
+		enums:      make(map[string]bool),
+		inherited:  make(map[string]bool),
+	}
+	core := false
+	for _, in := range inputs {
+		if in.Protocol.Name == "wayland" {
+			core = true
+		}
+		for _, iface := range in.Protocol.Interfaces {
+			known.interfaces[iface.Name] = true
+			for _, enum := range iface.Enums {
+				known.enums[iface.Name+"."+enum.Name] = true
+			}
+		}
+	}
+	if !core {
+		for _, name := range generator.InheritedNames {
+			if !known.interfaces[name] {
+				known.interfaces[name] = true
+				known.inherited[name] = true
+			}
+		}
+	}
+	return known
+}
+
+type linter struct {
+	file  string
+	diags []Diagnostic
+}
+
+func (l *linter) errorf(rule string, line int, format string, args ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{
+		File:     l.file,
+		Line:     line,
+		Severity: severityError,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) warnf(rule string, line int, format string, args ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{
+		File:     l.file,
+		Line:     line,
+		Severity: severityWarning,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) protocol(prot *Protocol) {
+	if prot.Name == "" {
+		l.errorf("protocol-name", prot.Line, "protocol has no name")
+	}
+	if len(prot.Interfaces) == 0 {
+		l.errorf("no-interfaces", prot.Line, "protocol %s defines no interfaces", prot.Name)
+	}
+	for i := range prot.Interfaces {
+		l.iface(&prot.Interfaces[i])
+	}
+}
+
+func (l *linter) iface(iface *Interface) {
+	if iface.Name == "" {
+		l.errorf("interface-name", iface.Line, "interface has no name")
+	}
+	if len(iface.Requests) == 0 && len(iface.Events) == 0 && len(iface.Enums) == 0 {
+		l.warnf("empty-interface", iface.Line, "interface %s is empty", iface.Name)
+	}
+	if iface.Unversioned {
+		l.warnf("missing-version", iface.Line, "interface %s has no version, so is taken to be version 1", iface.Name)
+	}
+	l.versions(iface)
+	l.docs("interface "+iface.Name, iface.Description, iface.Line)
+
+	for _, req := range iface.Requests {
+		l.message(iface, "request", req.Name, req.Line, req.Args)
+		l.docs("request "+iface.Name+"."+req.Name, req.Description, req.Line)
+		l.argDocs("request "+iface.Name+"."+req.Name, req.Args)
+	}
+	for _, ev := range iface.Events {
+		l.message(iface, "event", ev.Name, ev.Line, ev.Args)
+		l.docs("event "+iface.Name+"."+ev.Name, ev.Description, ev.Line)
+		l.argDocs("event "+iface.Name+"."+ev.Name, ev.Args)
+	}
+	for i := range iface.Enums {
+		enum := &iface.Enums[i]
+		l.enum(iface, enum)
+		l.docs("enum "+iface.Name+"."+enum.Name, enum.Description, enum.Line)
+		for _, entry := range enum.Entries {
+			if entry.Summary == "" && entry.Name != "" {
+				l.warnf("missing-summary", entry.Line, "entry %s.%s.%s has no summary", iface.Name, enum.Name, entry.Name)
+			}
+		}
+	}
+}
+
+// docs warns about an interface, message or enum that is not
+// documented, or whose description has no summary, since the generated
+// godoc comes from them.
+func (l *linter) docs(what string, d Description, line int) {
+	switch {
+	case d.Summary == "" && protocol.Text(d.Text) == "":
+		l.warnf("missing-description", line, "%s has no description", what)
+	case d.Summary == "":
+		l.warnf("missing-summary", line, "%s has no summary", what)
+	}
+}
+
+// argDocs warns about the args of a message without a summary.  Args
+// without a name are reported as errors already.
+func (l *linter) argDocs(msg string, args []Arg) {
+	for _, arg := range args {
+		if arg.Summary == "" && arg.Name != "" {
+			l.warnf("missing-summary", arg.Line, "arg %s of %s has no summary", arg.Name, msg)
+		}
+	}
+}
+
+func (l *linter) enum(iface *Interface, enum *Enum) {
+	if enum.Name == "" {
+		l.errorf("enum-name", enum.Line, "enum in %s has no name", iface.Name)
+	}
+
+	seen := make(map[string]int)
+	for _, entry := range enum.Entries {
+		if entry.Name == "" {
+			l.errorf("entry-name", entry.Line, "entry in %s.%s has no name", iface.Name, enum.Name)
+		} else if prev, ok := seen[entry.Name]; ok {
+			l.errorf("duplicate-entry", entry.Line, "entry %s.%s.%s is already defined on line %d",
+				iface.Name, enum.Name, entry.Name, prev)
+		} else {
+			seen[entry.Name] = entry.Line
+		}
+
+		value, err := strconv.ParseUint(entry.Value, 0, 64)
+		if err != nil {
+			l.errorf("entry-value", entry.Line, "entry %s.%s.%s has non-numeric value %q",
+				iface.Name, enum.Name, entry.Name, entry.Value)
+			continue
+		}
+		if value > math.MaxUint32 {
+			l.errorf("entry-range", entry.Line, "entry %s.%s.%s has value %s, which does not fit in a uint32",
+				iface.Name, enum.Name, entry.Name, entry.Value)
+			continue
+		}
+		if enum.BitField && value&(value-1) != 0 {
+			l.warnf("bitfield-value", entry.Line, "entry %s.%s.%s in a bitfield has value %s, which is not a power of two",
+				iface.Name, enum.Name, entry.Name, entry.Value)
+		}
+	}
+}
+
+// versions reports messages, enums and entries that claim to have been
+// added in a later version than the interface declares.
+func (l *linter) versions(iface *Interface) {
+	check := func(what string, since, line int) {
+		if since > iface.Version {
+			l.errorf("since-version", line, "%s is since version %d but %s is only version %d",
+				what, since, iface.Name, iface.Version)
+		}
+	}
+	for _, req := range iface.Requests {
+		check("request "+iface.Name+"."+req.Name, req.Since, req.Line)
+	}
+	for _, ev := range iface.Events {
+		check("event "+iface.Name+"."+ev.Name, ev.Since, ev.Line)
+	}
+	for _, enum := range iface.Enums {
+		check("enum "+iface.Name+"."+enum.Name, enum.Since, enum.Line)
+		for _, entry := range enum.Entries {
+			check("entry "+iface.Name+"."+enum.Name+"."+entry.Name, entry.Since, entry.Line)
+		}
+	}
+}
+
+// references reports object and new_id args that name an interface
+// which is not known, and so could not be given a Go type, and enum
+// attributes that do not name a known enum.  Enums of the interfaces
+// inherited from package wl cannot be checked, and are assumed to exist.
+func (l *linter) references(prot *Protocol, known *knownNames) {
+	check := func(iface *Interface, kind, msg string, args []Arg) {
+		for _, arg := range args {
+			if (arg.Type == "object" || arg.Type == "new_id") &&
+				arg.Interface != "" && !known.interfaces[arg.Interface] {
+				l.errorf("unknown-interface", arg.Line, "arg %s of %s %s.%s refers to unknown interface %s",
+					arg.Name, kind, iface.Name, msg, arg.Interface)
+			}
+			if arg.Enum == "" {
+				continue
+			}
+			ref := arg.Enum
+			if !strings.Contains(ref, ".") {
+				ref = iface.Name + "." + ref
+			}
+			owner := ref[:strings.Index(ref, ".")]
+			if !known.enums[ref] && !known.inherited[owner] {
+				l.errorf("unknown-enum", arg.Line, "arg %s of %s %s.%s refers to unknown enum %s",
+					arg.Name, kind, iface.Name, msg, arg.Enum)
+			}
+		}
+	}
+	for i := range prot.Interfaces {
+		iface := &prot.Interfaces[i]
+		for _, req := range iface.Requests {
+			if !req.Excluded {
+				check(iface, "request", req.Name, req.Args)
+			}
+		}
+		for _, ev := range iface.Events {
+			if !ev.Excluded {
+				check(iface, "event", ev.Name, ev.Args)
+			}
+		}
+	}
+}
+
+func (l *linter) message(iface *Interface, kind, name string, line int, args []Arg) {
+	if name == "" {
+		l.errorf("message-name", line, "%s in %s has no name", kind, iface.Name)
+	}
+
+	newId, after := "", false
+	for i, arg := range args {
+		if arg.Name == "" {
+			l.errorf("arg-name", arg.Line, "arg %d of %s.%s has no name", i, iface.Name, name)
+		}
+		if !wlArgTypes[arg.Type] {
+			l.errorf("arg-type", arg.Line, "arg %s of %s.%s has unknown type %q",
+				arg.Name, iface.Name, name, arg.Type)
+		}
+		if arg.Type != "new_id" {
+			if newId != "" && !after {
+				after = true
+				l.warnf("args-after-new-id", arg.Line, "%s.%s has args after new_id %s, starting with %s",
+					iface.Name, name, newId, arg.Name)
+			}
+			continue
+		}
+		if newId != "" {
+			l.errorf("multiple-new-id", arg.Line, "%s.%s has more than one new_id (%s and %s)",
+				iface.Name, name, newId, arg.Name)
+		}
+		newId = arg.Name
+	}
+}
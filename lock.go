@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// A lockFile pins the remote sources of a config to what was fetched
+// when they were locked, so that a run generates from the same XML
+// until the pins are deliberately updated.
+type lockFile struct {
+	Protocols []*pin `json:"protocols"`
+}
+
+type pin struct {
+	Source   string `json:"source"` // as in the config
+	URL      string `json:"url"`    // it was fetched from, after mirrors and redirects
+	Protocol string `json:"protocol"`
+	Version  int    `json:"version"` // highest interface version
+	SHA256   string `json:"sha256"`
+}
+
+// lockPath is where the lock file of a config goes: next to it, named
+// after it.
+func lockPath(config string) string {
+	return strings.TrimSuffix(config, filepath.Ext(config)) + ".lock"
+}
+
+// readLock reads a lock file, or returns nil if there is none.
+func readLock(file string) *lockFile {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	lock := &lockFile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		log.Fatalf("%s: %s", file, err)
+	}
+	return lock
+}
+
+func (lock *lockFile) write(file string) {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (lock *lockFile) find(source string) *pin {
+	for _, p := range lock.Protocols {
+		if p.Source == source {
+			return p
+		}
+	}
+	return nil
+}
+
+// pinJobs gives the remote sources of a config's jobs their pins,
+// failing for any that is not locked.
+func (lock *lockFile) pinJobs(file string, jobs []*job) {
+	for _, j := range jobs {
+		if !isRemote(j.Source) {
+			continue
+		}
+		j.pin = lock.find(j.Source)
+		if j.pin == nil {
+			log.Fatalf("%s is not in %s; run wl-scanner lock to pin it", j.Source, file)
+		}
+	}
+}
+
+// fetch fetches the pinned source, from where it was fetched when
+// locked, or failing that from the source itself or its mirrors, and
+// checks that it is what was locked.  It also returns the URL the
+// data came from.
+func (p *pin) fetch(mirrors []string) ([]byte, string) {
+	data, from := fetchAny(p.URL, append([]string{p.Source}, mirrors...))
+	if sum := sha256Hex(data); sum != p.SHA256 {
+		log.Fatalf("%s has changed since it was locked (sha256 %s, locked %s); run wl-scanner update to take the change",
+			p.Source, sum, p.SHA256)
+	}
+	return data, from
+}
+
+// newPin fetches a source to pin it.
+func newPin(source string, mirrors []string) *pin {
+	data, from := fetchAny(source, mirrors)
+	prot, err := protocol.Decode(source, data)
+	if err != nil {
+		log.Fatalf("%s: %s", source, err)
+	}
+	version := 0
+	for _, iface := range prot.Interfaces {
+		if iface.Version > version {
+			version = iface.Version
+		}
+	}
+	return &pin{
+		Source:   source,
+		URL:      from,
+		Protocol: prot.Name,
+		Version:  version,
+		SHA256:   sha256Hex(data),
+	}
+}
+
+// runLock implements "wl-scanner lock", which pins the remote sources
+// of a config that are not pinned yet and drops the pins of those no
+// longer in it, and "wl-scanner update", which fetches the sources
+// again (all of them, or those named) and pins what it gets.
+func runLock(cmd string, args []string) {
+	if len(args) == 0 || (cmd == "lock" && len(args) != 1) {
+		log.Fatalf("usage: wl-scanner lock wl-scanner.json\n       wl-scanner update wl-scanner.json [source...]")
+	}
+	file := args[0]
+	cfg, err := readConfig(file)
+	if err != nil {
+		log.Fatalf("%s: %s", file, err)
+	}
+	lockFileName := lockPath(file)
+	old := readLock(lockFileName)
+	if old == nil {
+		old = &lockFile{}
+	}
+
+	update := make(map[string]bool)
+	for _, source := range args[1:] {
+		update[source] = true
+	}
+	all := len(update) == 0
+	lock := &lockFile{}
+	for _, j := range cfg.Packages {
+		if !isRemote(j.Source) || lock.find(j.Source) != nil {
+			continue
+		}
+		prev := old.find(j.Source)
+		refetch := cmd == "update" && (all || update[j.Source])
+		delete(update, j.Source)
+		if prev != nil && !refetch {
+			lock.Protocols = append(lock.Protocols, prev)
+			continue
+		}
+		p := newPin(j.Source, j.Mirrors)
+		lock.Protocols = append(lock.Protocols, p)
+		if !*quiet {
+			switch {
+			case prev == nil:
+				log.Printf("%s: pinned %s version %d", j.Source, p.Protocol, p.Version)
+			case prev.SHA256 == p.SHA256:
+				log.Printf("%s: unchanged", j.Source)
+			default:
+				log.Printf("%s: version %d -> %d, sha256 %.12s -> %.12s", j.Source, prev.Version, p.Version, prev.SHA256, p.SHA256)
+			}
+		}
+	}
+	for source := range update {
+		log.Fatalf("%s is not a remote source of %s", source, file)
+	}
+	for _, p := range old.Protocols {
+		if lock.find(p.Source) == nil && !*quiet {
+			log.Printf("%s: no longer in %s, unpinned", p.Source, file)
+		}
+	}
+	lock.write(lockFileName)
+}
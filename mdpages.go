@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// A creator is a request or event with a new_id arg creating objects
+// of an interface.
+type creator struct {
+	Interface, Kind, Name string
+}
+
+// creatorsOf maps each interface of prot to the messages creating it.
+// new_id args of no particular interface, like wl_registry.bind's,
+// create none.
+func creatorsOf(prot *Protocol) map[string][]creator {
+	creators := make(map[string][]creator)
+	add := func(iface, kind, name string, args []Arg) {
+		for _, arg := range args {
+			if arg.Type == "new_id" && arg.Interface != "" {
+				creators[arg.Interface] = append(creators[arg.Interface], creator{iface, kind, name})
+			}
+		}
+	}
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			add(iface.Name, "request", req.Name, req.Args)
+		}
+		for _, ev := range iface.Events {
+			add(iface.Name, "event", ev.Name, ev.Args)
+		}
+	}
+	return creators
+}
+
+// writeMarkdownPages renders prot as a directory of Markdown pages:
+// index.md listing the interfaces, and one page per interface, linking
+// to the pages of the interfaces its args take or create, of the enums
+// they refer to, and of the requests and events creating it.
+func writeMarkdownPages(prot *Protocol, dir string) {
+	defined := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		defined[iface.Name] = true
+	}
+	creators := creatorsOf(prot)
+
+	funcs := template.FuncMap{
+		"text": protocol.Text,
+		"cell": docCell,
+		"page": func(iface string) string {
+			return iface + ".md"
+		},
+		"creators": func(iface string) []creator {
+			return creators[iface]
+		},
+		"argType": func(iface string, arg Arg) string {
+			t := "`" + arg.Type + "`"
+			if arg.Interface != "" {
+				if defined[arg.Interface] {
+					t += fmt.Sprintf(" [%s](%s.md)", arg.Interface, arg.Interface)
+				} else {
+					t += " " + arg.Interface
+				}
+			}
+			if arg.Enum != "" {
+				enumIface, enum := iface, arg.Enum
+				if i := strings.Index(enum, "."); i >= 0 {
+					enumIface, enum = enum[:i], enum[i+1:]
+				}
+				if defined[enumIface] {
+					t += fmt.Sprintf(" enum [`%s`](%s.md#enum-%s)", arg.Enum, enumIface, enum)
+				} else {
+					t += " enum `" + arg.Enum + "`"
+				}
+			}
+			if arg.AllowNull {
+				t += " (nullable)"
+			}
+			return t
+		},
+		"argsOf": func(iface string, args []Arg) interface{} {
+			return struct {
+				Iface string
+				Args  []Arg
+			}{iface, args}
+		},
+	}
+	tmpl := template.Must(template.New("MarkdownPages").Funcs(funcs).Parse(markdownPagesTemplate))
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		log.Fatal(err)
+	}
+
+	render := func(file, name string, data interface{}) {
+		f, err := os.Create(filepath.Join(dir, file))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err := tmpl.ExecuteTemplate(f, name, data); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	render("index.md", "index", prot)
+	for i := range prot.Interfaces {
+		render(prot.Interfaces[i].Name+".md", "interface", struct {
+			Protocol  *Protocol
+			Interface *Interface
+		}{prot, &prot.Interfaces[i]})
+	}
+}
+
+// Requests, events and enums get explicit anchors, since an event and
+// an enum can share a name, as wl_output's mode do.
+var markdownPagesTemplate = `
+{{- define "description" -}}
+{{- with .Summary}}
+
+_{{.}}_
+{{- end}}
+{{- with text .Text}}
+
+{{.}}
+{{- end}}
+{{- end}}
+
+{{- define "args" -}}
+{{- $iface := .Iface}}
+{{- if .Args}}
+
+| Argument | Type | Summary |
+|----------|------|---------|
+{{- range .Args}}
+| {{.Name}} | {{argType $iface .}} | {{cell .Summary}} |
+{{- end}}
+{{- end}}
+{{- end}}
+
+{{- define "index" -}}
+# {{.Name}}
+{{- template "description" .Description}}
+
+| Interface | Version | Summary |
+|-----------|---------|---------|
+{{- range .Interfaces}}
+| [{{.Name}}]({{page .Name}}) | {{.Version}} | {{cell .Description.Summary}} |
+{{- end}}
+{{end}}
+
+{{- define "interface" -}}
+[{{.Protocol.Name}}](index.md)
+{{- with .Interface}}
+{{- $iface := .Name}}
+
+# {{.Name}}
+{{- template "description" .Description}}
+
+Version {{.Version}}.
+{{- with creators .Name}}
+
+Created by
+{{- range $n, $c := .}}{{if $n}},{{end}} [{{$c.Interface}}.{{$c.Name}}]({{page $c.Interface}}#{{$c.Kind}}-{{$c.Name}}){{if eq $c.Kind "event"}} (event){{end}}{{end}}.
+{{- end}}
+{{- if .Requests}}
+
+## Requests
+{{- range $opcode, $req := .Requests}}
+
+<a id="request-{{.Name}}"></a>
+### {{$iface}}.{{.Name}}
+{{- template "description" .Description}}
+
+Opcode {{$opcode}}{{if gt .Since 1}}, since version {{.Since}}{{end}}{{if eq .Type "destructor"}}, destructor{{end}}.
+{{- template "args" (argsOf $iface .Args)}}
+{{- end}}
+{{- end}}
+{{- if .Events}}
+
+## Events
+{{- range $opcode, $ev := .Events}}
+
+<a id="event-{{.Name}}"></a>
+### {{$iface}}.{{.Name}}
+{{- template "description" .Description}}
+
+Opcode {{$opcode}}{{if gt .Since 1}}, since version {{.Since}}{{end}}.
+{{- template "args" (argsOf $iface .Args)}}
+{{- end}}
+{{- end}}
+{{- if .Enums}}
+
+## Enums
+{{- range .Enums}}
+
+<a id="enum-{{.Name}}"></a>
+### {{$iface}}.{{.Name}}
+{{- with .Description.Summary}}
+
+_{{.}}_
+{{- end}}
+{{- if or .BitField (gt .Since 1)}}
+
+{{if .BitField}}Bitfield.{{end}}{{if and .BitField (gt .Since 1)}} {{end}}{{if gt .Since 1}}Since version {{.Since}}.{{end}}
+{{- end}}
+{{- with text .Description.Text}}
+
+{{.}}
+{{- end}}
+
+| Entry | Value | Summary |
+|-------|-------|---------|
+{{- range .Entries}}
+| {{.Name}} | {{.Value}} | {{cell .Summary}}{{if gt .Since 1}} (since version {{.Since}}){{end}} |
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{end}}
+`
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// cMessage is one entry of a wl_message table generated by the C
+// wayland-scanner, with the interfaces of its arguments resolved from
+// the shared types array ("" for non-object arguments).
+type cMessage struct {
+	Name      string
+	Signature string
+	Types     []string
+}
+
+type cInterface struct {
+	Name     string
+	Version  int
+	Requests []cMessage
+	Events   []cMessage
+	Line     int
+}
+
+var (
+	cTypesDecl   = regexp.MustCompile(`(?s)static const struct wl_interface \*(\w+)\[\] = \{(.*?)\};`)
+	cTypeEntry   = regexp.MustCompile(`&(\w+)_interface|NULL`)
+	cMessageDecl = regexp.MustCompile(`(?s)static const struct wl_message (\w+)\[\] = \{(.*?)\n\};`)
+	cMessageItem = regexp.MustCompile(`\{ "(\w+)", "([^"]*)", (\w+) \+ (\d+) \}`)
+	cIfaceDecl   = regexp.MustCompile(`(?s)const struct wl_interface (\w+)_interface = \{\s*"(\w+)", (\d+),\s*(\d+), (\w+),\s*(\d+), (\w+),\s*\};`)
+)
+
+// parseCProtocol extracts the interface tables from the private code
+// (the "-protocol.c" file) generated by the C wayland-scanner.
+func parseCProtocol(src []byte) (map[string]*cInterface, error) {
+	types := make(map[string][]string)
+	for _, m := range cTypesDecl.FindAllSubmatch(src, -1) {
+		var list []string
+		for _, e := range cTypeEntry.FindAllSubmatch(m[2], -1) {
+			list = append(list, string(e[1]))
+		}
+		types[string(m[1])] = list
+	}
+
+	messages := make(map[string][]cMessage)
+	for _, m := range cMessageDecl.FindAllSubmatch(src, -1) {
+		var list []cMessage
+		for _, e := range cMessageItem.FindAllSubmatch(m[2], -1) {
+			msg := cMessage{Name: string(e[1]), Signature: string(e[2])}
+			table, ok := types[string(e[3])]
+			if !ok {
+				return nil, fmt.Errorf("message %s refers to unknown types array %s", msg.Name, e[3])
+			}
+			start, _ := strconv.Atoi(string(e[4]))
+			n := len(strings.Trim(msg.Signature, "0123456789?"))
+			if start+n > len(table) {
+				return nil, fmt.Errorf("message %s runs past the end of %s", msg.Name, e[3])
+			}
+			msg.Types = table[start : start+n]
+			list = append(list, msg)
+		}
+		messages[string(m[1])] = list
+	}
+
+	ifaces := make(map[string]*cInterface)
+	for _, idx := range cIfaceDecl.FindAllSubmatchIndex(src, -1) {
+		field := func(i int) string { return string(src[idx[2*i]:idx[2*i+1]]) }
+		iface := &cInterface{
+			Name: field(2),
+			Line: 1 + bytes.Count(src[:idx[0]], []byte("\n")),
+		}
+		iface.Version, _ = strconv.Atoi(field(3))
+		iface.Requests = messages[field(5)]
+		iface.Events = messages[field(7)]
+		if n, _ := strconv.Atoi(field(4)); n != len(iface.Requests) {
+			return nil, fmt.Errorf("%s declares %d requests but its table has %d", iface.Name, n, len(iface.Requests))
+		}
+		if n, _ := strconv.Atoi(field(6)); n != len(iface.Events) {
+			return nil, fmt.Errorf("%s declares %d events but its table has %d", iface.Name, n, len(iface.Events))
+		}
+		ifaces[iface.Name] = iface
+	}
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("no interface definitions found")
+	}
+	return ifaces, nil
+}
+
+// wireTypes returns the interface of each wire argument of a message,
+// matching the layout of the C scanner's types array.
+func wireTypes(args []Arg) []string {
+	var types []string
+	for _, arg := range args {
+		if arg.Type == "new_id" && arg.Interface == "" {
+			types = append(types, "", "")
+		}
+		if arg.Type == "object" || arg.Type == "new_id" {
+			types = append(types, arg.Interface)
+		} else {
+			types = append(types, "")
+		}
+	}
+	return types
+}
+
+// runVerifyC implements "wl-scanner verify-c protocol.xml protocol.c",
+// checking that the opcodes and signatures the Go bindings would use
+// for every message match those of the C reference implementation.
+func runVerifyC(args []string) {
+	if len(args) != 2 {
+		log.Fatal("usage: wl-scanner verify-c protocol.xml protocol.c")
+	}
+	xmlFile, cFile := args[0], args[1]
+
+	prot := readProtocol(xmlFile)
+
+	src, err := ioutil.ReadFile(cFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cIfaces, err := parseCProtocol(src)
+	if err != nil {
+		log.Fatalf("%s: %s", cFile, err)
+	}
+
+	diags := compareWithC(xmlFile, prot, cIfaces)
+	if reportDiagnostics(diags) > 0 {
+		os.Exit(1)
+	}
+	if !*quiet {
+		log.Printf("%s: %d interfaces match %s", xmlFile, len(prot.Interfaces), cFile)
+	}
+}
+
+func compareWithC(file string, prot *Protocol, cIfaces map[string]*cInterface) []Diagnostic {
+	var diags []Diagnostic
+	errorf := func(rule string, line int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Line:     line,
+			Severity: severityError,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	type message struct {
+		name  string
+		since int
+		args  []Arg
+		line  int
+	}
+	compare := func(iface, kind string, ours []message, theirs []cMessage) {
+		if len(ours) != len(theirs) {
+			errorf("parity-count", 0, "%s has %d %ss but the C tables have %d", iface, len(ours), kind, len(theirs))
+		}
+		for op := 0; op < len(ours) && op < len(theirs); op++ {
+			m, c := ours[op], theirs[op]
+			if m.name != c.Name {
+				errorf("parity-opcode", m.line, "%s %s opcode %d is %s, but %s in the C tables",
+					iface, kind, op, m.name, c.Name)
+				continue
+			}
+			if sig := protocol.Signature(m.since, m.args); sig != c.Signature {
+				errorf("parity-signature", m.line, "%s.%s has signature %q, but %q in the C tables",
+					iface, m.name, sig, c.Signature)
+				continue
+			}
+			types := wireTypes(m.args)
+			for i := range types {
+				if types[i] != c.Types[i] {
+					errorf("parity-interface", m.line, "%s.%s argument %d has interface %q, but %q in the C tables",
+						iface, m.name, i, types[i], c.Types[i])
+				}
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		seen[iface.Name] = true
+		c, ok := cIfaces[iface.Name]
+		if !ok {
+			errorf("parity-missing", iface.Line, "interface %s is missing from the C tables", iface.Name)
+			continue
+		}
+		if c.Version != iface.Version {
+			errorf("parity-version", iface.Line, "%s is version %d, but version %d in the C tables",
+				iface.Name, iface.Version, c.Version)
+		}
+
+		var reqs, evs []message
+		for _, r := range iface.Requests {
+			reqs = append(reqs, message{r.Name, r.Since, r.Args, r.Line})
+		}
+		for _, e := range iface.Events {
+			evs = append(evs, message{e.Name, e.Since, e.Args, e.Line})
+		}
+		compare(iface.Name, "request", reqs, c.Requests)
+		compare(iface.Name, "event", evs, c.Events)
+	}
+	var extra []string
+	for name := range cIfaces {
+		if !seen[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		errorf("parity-extra", 0, "interface %s (C tables line %d) is missing from the protocol", name, cIfaces[name].Line)
+	}
+	return diags
+}
@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// Annotations (see protocol.Annotate) rename requests, events and
+// their arguments, give arrays of unsigned elements their Go type, and
+// document the units and ownership of arguments.
+
+// MessageName returns the Go name of a request's method, or of an
+// event in its type and handler names, which an annotation may give.
+func (o Options) MessageName(wlName string, a *protocol.Annotation) string {
+	if a != nil && a.GoName != "" {
+		return a.GoName
+	}
+	return o.GoName(wlName)
+}
+
+func (g *Generator) messageName(wlName string, a *protocol.Annotation) string {
+	if a != nil && a.GoName != "" {
+		return a.GoName
+	}
+	return g.camelCase(wlName)
+}
+
+// argName returns the name of a request's parameter for arg.
+func argName(arg protocol.Arg) string {
+	if arg.Annotation != nil && arg.Annotation.GoName != "" {
+		return arg.Annotation.GoName
+	}
+	return arg.Name
+}
+
+// fieldName returns the name of an event's field for arg.
+func (g *Generator) fieldName(arg protocol.Arg) string {
+	if arg.Annotation != nil && arg.Annotation.GoName != "" {
+		return arg.Annotation.GoName
+	}
+	return g.camelCase(arg.Name)
+}
+
+// unsigned reports whether arg is an array annotated as holding uint32s.
+func unsigned(arg protocol.Arg) bool {
+	return arg.Type == "array" && arg.Annotation != nil && arg.Annotation.Element == "uint32"
+}
+
+// argComment describes what annotations say about arg that its type
+// does not, as a comment on the event field.
+func argComment(arg protocol.Arg) string {
+	a := arg.Annotation
+	switch {
+	case a == nil:
+		return ""
+	case a.Unit != "":
+		return "in " + protocol.Units[a.Unit]
+	case a.Ownership == "owned":
+		return "owned by the handler, which must close it"
+	case a.Ownership == "borrowed":
+		return "borrowed: the handler must not close or keep it"
+	}
+	return ""
+}
+
+// argDocs documents the units of a request's parameters, for its doc
+// comment.
+func argDocs(args []protocol.Arg) string {
+	docs := ""
+	for _, arg := range args {
+		if a := arg.Annotation; a != nil && a.Unit != "" {
+			docs += fmt.Sprintf("// %s is in %s.\n", argName(arg), protocol.Units[a.Unit])
+		}
+	}
+	return docs
+}
+
+// Decoded is the expression decoding the argument from an event.
+func (a GoArg) Decoded() string {
+	if a.Convert != "" {
+		return fmt.Sprintf("%s(event.%s)", a.Convert, a.BufMethod)
+	}
+	return "event." + a.BufMethod
+}
+
+// arrayConversions are the conversion functions the uint32 arrays of
+// a protocol need.
+type arrayConversions struct {
+	Events, Requests bool
+	Generic          bool // one generic function for both
+}
+
+func arrayConversionsOf(prot *protocol.Protocol) arrayConversions {
+	var c arrayConversions
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			for _, arg := range req.Args {
+				c.Requests = c.Requests || (unsigned(arg) && !req.Excluded)
+			}
+		}
+		for _, ev := range iface.Events {
+			for _, arg := range ev.Args {
+				c.Events = c.Events || (unsigned(arg) && !ev.Excluded)
+			}
+		}
+	}
+	return c
+}
+
+var arrayConversionsTemplate = `
+{{- if .Generic}}
+
+// convertSlice converts an array between the int32s on the wire and
+// the uint32s an annotation says it holds.
+func convertSlice[To, From int32 | uint32](s []From) []To {
+	c := make([]To, len(s))
+	for i, v := range s {
+		c[i] = To(v)
+	}
+	return c
+}
+{{- else}}
+{{- if .Events}}
+
+// toUint32s converts an array decoded from an event to the uint32s an
+// annotation says it holds.
+func toUint32s(a []int32) []uint32 {
+	u := make([]uint32, len(a))
+	for i, v := range a {
+		u[i] = uint32(v)
+	}
+	return u
+}
+{{- end}}
+{{- if .Requests}}
+
+// toInt32s converts uint32s to the array a request sends.
+func toInt32s(u []uint32) []int32 {
+	a := make([]int32, len(u))
+	for i, v := range u {
+		a[i] = int32(v)
+	}
+	return a
+}
+{{- end}}
+{{- end}}
+`
@@ -0,0 +1,128 @@
+package generator
+
+import "github.com/dkolbly/wl-scanner/pkg/protocol"
+
+// Globals returns the names of the interfaces of prot that clients get
+// by binding them from the registry.  The XML does not say, so they are
+// taken to be the ones no request or event of the protocol creates,
+// less wl_display, which exists from the start.
+func Globals(prot *protocol.Protocol) []string {
+	created := map[string]bool{"wl_display": true}
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			markCreated(created, req.Args)
+		}
+		for _, ev := range iface.Events {
+			markCreated(created, ev.Args)
+		}
+	}
+	var globals []string
+	for _, iface := range prot.Interfaces {
+		if !created[iface.Name] {
+			globals = append(globals, iface.Name)
+		}
+	}
+	return globals
+}
+
+func markCreated(created map[string]bool, args []protocol.Arg) {
+	for _, arg := range args {
+		if arg.Type == "new_id" && arg.Interface != "" {
+			created[arg.Interface] = true
+		}
+	}
+}
+
+type (
+	bindersData struct {
+		WL      string // qualifier for wl runtime types; empty for the wl package itself
+		Globals []bindGlobal
+	}
+
+	bindGlobal struct {
+		Name    string // Go type
+		WlName  string
+		Version int // the highest the generated code supports
+	}
+)
+
+func (g *Generator) bindersOf(prot *protocol.Protocol) bindersData {
+	data := bindersData{WL: g.wlPrefix}
+	for _, iface := range prot.Interfaces {
+		if g.globals[iface.Name] {
+			data.Globals = append(data.Globals, bindGlobal{g.names[g.stripUnstable(iface.Name)], iface.Name, iface.Version})
+		}
+	}
+	return data
+}
+
+var bindersTemplate = `
+{{- $wl := .WL}}
+{{- range .Globals}}
+
+// {{.Name}}InterfaceName is the interface name {{.WlName}} globals are
+// advertised under by the registry.
+const {{.Name}}InterfaceName = "{{.WlName}}"
+
+// {{.Name}}MaxVersion is the highest version of {{.WlName}} this package
+// supports.
+const {{.Name}}MaxVersion = {{.Version}}
+
+// Bind{{.Name}} binds the {{.WlName}} global with the given name, as
+// announced by the registry's global event, at version.
+{{- if $wl}}
+func Bind{{.Name}}(r *{{$wl}}Registry, name, version uint32) (*{{.Name}}, error) {
+	ret := New{{.Name}}(r.Context())
+	ret.version = version
+	return ret, r.Bind(name, {{.Name}}InterfaceName, version, ret)
+}
+
+// Bind{{.Name}}AtLeast binds the {{.WlName}} global announced by the
+// registry at the preferred version, or at the highest the compositor
+// or this package supports if either is lower, failing if that is
+// below min.  The proxy's Version says which it got.
+func Bind{{.Name}}AtLeast(r *{{$wl}}Registry, global {{$wl}}RegistryGlobalEvent, min, preferred uint32) (*{{.Name}}, error) {
+	version, err := negotiate{{.Name}}(global, min, preferred)
+	if err != nil {
+		return nil, err
+	}
+	return Bind{{.Name}}(r, global.Name, version)
+}
+{{- else}}
+func (p *Registry) Bind{{.Name}}(name, version uint32) (*{{.Name}}, error) {
+	ret := New{{.Name}}(p.Context())
+	ret.version = version
+	return ret, p.Bind(name, {{.Name}}InterfaceName, version, ret)
+}
+
+// Bind{{.Name}}AtLeast binds the {{.WlName}} global announced by the
+// registry at the preferred version, or at the highest the compositor
+// or this package supports if either is lower, failing if that is
+// below min.  The proxy's Version says which it got.
+func (p *Registry) Bind{{.Name}}AtLeast(global RegistryGlobalEvent, min, preferred uint32) (*{{.Name}}, error) {
+	version, err := negotiate{{.Name}}(global, min, preferred)
+	if err != nil {
+		return nil, err
+	}
+	return p.Bind{{.Name}}(global.Name, version)
+}
+{{- end}}
+
+func negotiate{{.Name}}(global {{$wl}}RegistryGlobalEvent, min, preferred uint32) (uint32, error) {
+	if global.Interface != {{.Name}}InterfaceName {
+		return 0, fmt.Errorf("global %d is %s, not {{.WlName}}", global.Name, global.Interface)
+	}
+	version := preferred
+	if global.Version < version {
+		version = global.Version
+	}
+	if {{.Name}}MaxVersion < version {
+		version = {{.Name}}MaxVersion
+	}
+	if version < min {
+		return 0, fmt.Errorf("{{.WlName}} version %d is needed, but only %d is available", min, version)
+	}
+	return version, nil
+}
+{{- end}}
+`
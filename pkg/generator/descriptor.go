@@ -0,0 +1,38 @@
+package generator
+
+import "github.com/dkolbly/wl-scanner/pkg/protocol"
+
+// The descriptor summarizes a generated package: which protocol it is
+// for, and which interfaces at which versions it can speak, so that an
+// application can report what its binary supports.
+
+type descriptor struct {
+	Name       string
+	Interfaces []protocol.Interface
+}
+
+var descriptorTemplate = `
+// ProtocolInfo names a protocol and the interfaces of it a package
+// supports.
+type ProtocolInfo struct {
+	Name       string
+	Interfaces []ProtocolInterface
+}
+
+// ProtocolInterface is an interface and the highest version of it
+// supported.
+type ProtocolInterface struct {
+	Name    string
+	Version int
+}
+
+// Protocol describes what this package was generated from.
+var Protocol = ProtocolInfo{
+	Name: {{printf "%q" .Name}},
+	Interfaces: []ProtocolInterface{
+	{{- range .Interfaces}}
+		{ {{- printf "%q" .Name}}, {{.Version -}} },
+	{{- end}}
+	},
+}
+`
@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+// allocsTest measures the allocations of dispatching an event of four
+// ints to a handler, reusing one buffer as a connection's reader does.
+const allocsTest = `package sample
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/dkolbly/wl"
+)
+
+type regions struct{ area int32 }
+
+func (r *regions) HandleThingRegion(ev ThingRegionEvent) { r.area += ev.Rect.Width * ev.Rect.Height }
+
+func TestDispatchAllocs(t *testing.T) {
+	p := new(Thing)
+	r := new(regions)
+	p.AddRegionHandler(r)
+	data := []byte{1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0}
+	var buf bytes.Buffer
+	event := &wl.Event{Opcode: 0, Data: &buf}
+	allocs := testing.AllocsPerRun(1000, func() {
+		buf.Reset()
+		buf.Write(data)
+		p.Dispatch(event)
+	})
+	if r.area != 1001*12 {
+		t.Errorf("handled an area of %d, want %d", r.area, 1001*12)
+	}
+	fmt.Printf("allocs per event: %v\n", allocs)
+}
+`
+
+var allocsPerEvent = regexp.MustCompile(`allocs per event: ([0-9.]+)`)
+
+func TestDispatchAllocs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"plain", Options{}},
+		{"table", Options{DispatchTable: 2}},
+		{"strict", Options{StrictDecode: true}},
+		{"tracked", Options{TrackObjects: true, GuardDestroyed: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := runGenerated(t, sample(t), test.opts, allocsTest, "-run", "DispatchAllocs", "-v")
+			m := allocsPerEvent.FindStringSubmatch(out)
+			if m == nil {
+				t.Fatalf("go test printed no allocations:\n%s", out)
+			}
+			if m[1] != "0" {
+				t.Errorf("dispatch makes %s allocations per event, want 0", m[1])
+			}
+		})
+	}
+}
+
+func TestEventCount(t *testing.T) {
+	prot := sample(t)
+	tests := []struct {
+		opts Options
+		code string
+		want bool
+	}{
+		{Options{Package: "sample"}, "EventCount", false},
+		{Options{Package: "sample", DispatchTable: 2}, "const thingEventCount = 6\n", true},
+		{Options{Package: "sample", DispatchTable: 2}, "if event.Opcode >= thingEventCount {", true},
+		{Options{Package: "sample", DispatchTable: 2}, "managerEventCount", false}, // too few events for a table
+	}
+	for _, test := range tests {
+		src := generate(t, prot, test.opts)
+		if got := bytes.Contains(src, []byte(test.code)); got != test.want {
+			t.Errorf("with DispatchTable %d, generated code has %q: %v, want %v",
+				test.opts.DispatchTable, test.code, got, test.want)
+		}
+	}
+}
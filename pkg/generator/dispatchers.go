@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// checkDispatchers checks the generated source against the events of
+// its interfaces: a type with events must have the Dispatch method the
+// runtime delivers them through, and one without must not, since the
+// runtime would then hand it events that no handler is ever added for.
+// A Dispatch method from an appended snippet counts like any other.
+func checkDispatchers(file string, src []byte, generated []GoInterface) error {
+	f, err := parser.ParseFile(token.NewFileSet(), file, src, parser.SkipObjectResolution)
+	if err != nil {
+		return err
+	}
+	dispatches := make(map[string]bool) // by receiver type
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != "Dispatch" {
+			continue
+		}
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if id, ok := recv.(*ast.Ident); ok {
+			dispatches[id.Name] = true
+		}
+	}
+	for _, i := range generated {
+		switch {
+		case len(i.Events) > 0 && !dispatches[i.Name]:
+			return fmt.Errorf("%s: %s has events but no Dispatch method", file, i.Name)
+		case len(i.Events) == 0 && dispatches[i.Name]:
+			return fmt.Errorf("%s: %s has no events but a Dispatch method", file, i.Name)
+		}
+	}
+	return nil
+}
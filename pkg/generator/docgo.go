@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// docGoFile renders a doc.go carrying the package comment, so go doc
+// gives an overview of the protocol.
+func docGoFile(m *Model) ([]File, error) {
+	var buf bytes.Buffer
+	buf.WriteString(m.Header)
+	if err := docGoTmpl.Execute(&buf, m); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []File{{"doc.go", src}}, nil
+}
+
+// goComment turns protocol text into the body of a // comment,
+// keeping paragraph breaks.  indent is added in front of every
+// non-blank line, which go doc renders as preformatted text.
+func goComment(indent, text string) string {
+	var lines []string
+	for _, line := range strings.Split(protocol.Text(text), "\n") {
+		if line == "" {
+			lines = append(lines, "//")
+		} else {
+			lines = append(lines, "// "+indent+line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var docGoTmpl = template.Must(template.New("DocGoTemplate").Funcs(template.FuncMap{
+	"comment": goComment,
+	"oneline": func(text string) string {
+		return strings.Join(strings.Fields(text), " ")
+	},
+}).Parse(docGoTemplate))
+
+var docGoTemplate = `// Package {{.Options.Package}} is a client for the {{.Protocol.Name}} wayland protocol
+{{- with .Protocol.Description.Summary}} ({{oneline .}}){{end}}.
+{{- with .Protocol.Description.Text}}
+//
+{{comment "" .}}
+{{- end}}
+//
+// # Interfaces
+//
+{{- range .Interfaces}}
+//   - [{{.Name}}] {{.WlInterface.Name}}, version {{.WlInterface.Version}}
+{{- with .WlInterface.Description.Summary}}: {{oneline .}}{{end}}
+{{- end}}
+{{- with .Protocol.Copyright}}
+//
+// # Copyright
+//
+{{comment "  " .}}
+{{- end}}
+package {{.Options.Package}}
+`
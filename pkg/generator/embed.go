@@ -0,0 +1,21 @@
+package generator
+
+import "github.com/dkolbly/wl-scanner/pkg/protocol"
+
+// embeddedXMLName is the file the protocol XML is copied to, next to
+// the generated code, when EmbedXML is set.
+func embeddedXMLName(prot *protocol.Protocol) string {
+	return prot.Name + ".xml"
+}
+
+func embeddedXMLFile(m *Model) ([]File, error) {
+	return []File{{embeddedXMLName(m.Protocol), m.Options.SourceData}}, nil
+}
+
+var embedTemplate = `
+// ProtocolXML is the {{.}} protocol definition this package was
+// generated from.
+//
+//go:embed {{.}}.xml
+var ProtocolXML string
+`
@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// Model is what emitters work from: the protocol along with the Go
+// names the client code gives it.
+type Model struct {
+	Protocol   *protocol.Protocol
+	Interfaces []GoInterface
+	Options    Options
+	Header     string // the SPDX line and Header, for the top of Go files
+}
+
+// An Emitter produces artifacts from a Model.  Files are named relative
+// to the directory of the generated package.
+type Emitter interface {
+	Emit(m *Model) ([]File, error)
+}
+
+// EmitterFunc lets an ordinary function be used as an Emitter.
+type EmitterFunc func(m *Model) ([]File, error)
+
+func (f EmitterFunc) Emit(m *Model) ([]File, error) {
+	return f(m)
+}
+
+var (
+	emittersMu sync.RWMutex
+	registry   = make(map[string]Emitter)
+)
+
+// Register makes an emitter available by name, so tools built on the
+// generator can offer it for selection.  It panics if the name is
+// already taken.
+func Register(name string, e Emitter) {
+	emittersMu.Lock()
+	defer emittersMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("generator: Register called twice for emitter " + name)
+	}
+	registry[name] = e
+}
+
+// Lookup returns the emitter registered under name.
+func Lookup(name string) (Emitter, bool) {
+	emittersMu.RLock()
+	defer emittersMu.RUnlock()
+	e, ok := registry[name]
+	return e, ok
+}
+
+// Emitters returns the names of the registered emitters, sorted.
+func Emitters() []string {
+	emittersMu.RLock()
+	defer emittersMu.RUnlock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("doc.go", EmitterFunc(docGoFile))
+	Register("go.mod", EmitterFunc(goModFile))
+	Register("license", EmitterFunc(licenseFile))
+	Register("manifest", EmitterFunc(manifestFile))
+	Register("wire", EmitterFunc(wireFile))
+	Register("xml", EmitterFunc(embeddedXMLFile))
+}
+
+// emitters lists the built-in emitters the options ask for, followed by
+// the caller's own.
+func (g *Generator) emitters() []Emitter {
+	var es []Emitter
+	for _, b := range []struct {
+		name string
+		on   bool
+	}{
+		{"license", g.opts.License != ""},
+		{"doc.go", g.opts.DocGo},
+		{"wire", g.opts.WireTables},
+		{"xml", g.opts.EmbedXML},
+		{"manifest", g.opts.Manifest},
+		{"go.mod", g.opts.Module != ""},
+	} {
+		if b.on {
+			e, _ := Lookup(b.name)
+			es = append(es, e)
+		}
+	}
+	return append(es, g.opts.Emitters...)
+}
+
+// TemplateEmitter renders a text/template over the Model into the named
+// file.  A .go file gets the Header and is gofmt'd.
+func TemplateEmitter(name, text string) (Emitter, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return EmitterFunc(func(m *Model) ([]File, error) {
+		var buf bytes.Buffer
+		isGo := strings.HasSuffix(name, ".go")
+		if isGo {
+			buf.WriteString(m.Header)
+		}
+		if err := tmpl.Execute(&buf, m); err != nil {
+			return nil, err
+		}
+		data := buf.Bytes()
+		if isGo {
+			if data, err = format.Source(data); err != nil {
+				return nil, fmt.Errorf("Cannot format %s: %s", name, err)
+			}
+		}
+		return []File{{name, data}}, nil
+	}), nil
+}
+
+// parseSnippets parses interface snippets, which must each be for an
+// interface of prot.
+func parseSnippets(prot *protocol.Protocol, srcs map[string]string) (map[string]*template.Template, error) {
+	if len(srcs) == 0 {
+		return nil, nil
+	}
+	defined := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		defined[iface.Name] = true
+	}
+	var names []string
+	for name := range srcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	snippets := make(map[string]*template.Template)
+	for _, name := range names {
+		src := srcs[name]
+		if !defined[name] {
+			return nil, fmt.Errorf("snippet for %s, which is not an interface of %s", name, prot.Name)
+		}
+		t, err := template.New(name).Parse(src)
+		if err != nil {
+			return nil, err
+		}
+		snippets[name] = t
+	}
+	return snippets, nil
+}
@@ -0,0 +1,186 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// An enum annotated fourcc, such as wl_shm.format, holds DRM fourcc
+// codes, and gets functions converting its values to and from the
+// codes and their four characters, and telling how many bytes a pixel
+// of each takes, which software-rendering clients otherwise write for
+// themselves.
+
+// FourCCFuncs are the names, after the Go name of the enum, of the
+// functions generated for a fourcc enum.
+var FourCCFuncs = []string{"FourCC", "FromFourCC", "FourCCString", "ParseFourCC", "BytesPerPixel"}
+
+// renumbered are the fourcc codes of the formats wl_shm numbers apart
+// from their codes, the two every compositor supports.
+var renumbered = map[string]string{
+	"argb8888": "AR24",
+	"xrgb8888": "XR24",
+}
+
+// bytesPerPixel are the sizes of a pixel of the single-plane formats,
+// by their DRM names, which wl_shm's entries have.  Packed YUV formats
+// take two pixels in four bytes.
+var bytesPerPixel = map[string]int{
+	"c8": 1, "r8": 1, "rgb332": 1, "bgr233": 1,
+
+	"r16": 2, "rg88": 2, "gr88": 2,
+	"xrgb4444": 2, "xbgr4444": 2, "rgbx4444": 2, "bgrx4444": 2,
+	"argb4444": 2, "abgr4444": 2, "rgba4444": 2, "bgra4444": 2,
+	"xrgb1555": 2, "xbgr1555": 2, "rgbx5551": 2, "bgrx5551": 2,
+	"argb1555": 2, "abgr1555": 2, "rgba5551": 2, "bgra5551": 2,
+	"rgb565": 2, "bgr565": 2,
+	"yuyv": 2, "yvyu": 2, "uyvy": 2, "vyuy": 2,
+
+	"rgb888": 3, "bgr888": 3,
+
+	"xrgb8888": 4, "xbgr8888": 4, "rgbx8888": 4, "bgrx8888": 4,
+	"argb8888": 4, "abgr8888": 4, "rgba8888": 4, "bgra8888": 4,
+	"xrgb2101010": 4, "xbgr2101010": 4, "rgbx1010102": 4, "bgrx1010102": 4,
+	"argb2101010": 4, "abgr2101010": 4, "rgba1010102": 4, "bgra1010102": 4,
+	"rg1616": 4, "gr1616": 4, "ayuv": 4, "xyuv8888": 4,
+
+	"xrgb16161616": 8, "xbgr16161616": 8, "argb16161616": 8, "abgr16161616": 8,
+	"xrgb16161616f": 8, "xbgr16161616f": 8, "argb16161616f": 8, "abgr16161616f": 8,
+}
+
+type (
+	fourCCEnum struct {
+		Prefix, WlName string // ShmFormat, wl_shm.format
+		Values         string // the constants of the distinct values, for a case
+		Renumbered     []fourCCEntry
+		Sizes          []fourCCSize
+	}
+
+	fourCCEntry struct {
+		Const, Code, Chars string
+	}
+
+	fourCCSize struct {
+		Bytes  int
+		Values string // the constants of the values whose pixels take Bytes
+	}
+)
+
+// isFourCC reports whether v spells four printable characters.
+func isFourCC(v uint64) bool {
+	for n := 0; n < 4; n++ {
+		if c := byte(v >> (8 * n)); c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return v <= 0xffffffff
+}
+
+// fourCCOf gathers what the fourcc functions of enum need.  Entries
+// whose value is not a code, nor one renumbered, are warned about and
+// left out.
+func (g *Generator) fourCCOf(enum GoEnum, wlEnum protocol.Enum) fourCCEnum {
+	prefix := enum.IfaceName + enum.Name
+	e := fourCCEnum{Prefix: prefix, WlName: enum.WlIfaceName + "." + enum.WlName}
+	var values []string
+	sizes := make(map[int][]string)
+	for _, entry := range enum.Distinct {
+		v, _ := strconv.ParseUint(entry.Value, 10, 32)
+		name := prefix + entry.Name
+		if chars, ok := renumbered[entry.WlName]; ok && !isFourCC(v) {
+			code := uint32(chars[0]) | uint32(chars[1])<<8 | uint32(chars[2])<<16 | uint32(chars[3])<<24
+			e.Renumbered = append(e.Renumbered, fourCCEntry{name, "0x" + strconv.FormatUint(uint64(code), 16), chars})
+		} else if !isFourCC(v) {
+			line := wlEnum.Line
+			for _, wlEntry := range wlEnum.Entries {
+				if wlEntry.Name == entry.WlName {
+					line = wlEntry.Line
+				}
+			}
+			g.warnf("fourcc", line, "entry %s.%s has value %s, which is not a fourcc code", e.WlName, entry.WlName, entry.Value)
+			continue
+		}
+		values = append(values, name)
+		if n := bytesPerPixel[entry.WlName]; n > 0 {
+			sizes[n] = append(sizes[n], name)
+		}
+	}
+	e.Values = strings.Join(values, ", ")
+	for _, n := range []int{1, 2, 3, 4, 8} {
+		if len(sizes[n]) > 0 {
+			e.Sizes = append(e.Sizes, fourCCSize{n, strings.Join(sizes[n], ", ")})
+		}
+	}
+	return e
+}
+
+var fourCCTemplate = `
+{{- if .Values}}
+
+// {{.Prefix}}FourCC returns the DRM fourcc code of a {{.WlName}}
+// value, which is the value itself but for those the protocol numbers
+// otherwise.
+func {{.Prefix}}FourCC(v uint32) uint32 {
+	{{- if .Renumbered}}
+	switch v {
+	{{- range .Renumbered}}
+	case {{.Const}}:
+		return {{.Code}} // {{.Chars}}
+	{{- end}}
+	}
+	{{- end}}
+	return v
+}
+
+// {{.Prefix}}FromFourCC returns the {{.WlName}} value of a DRM fourcc
+// code.
+func {{.Prefix}}FromFourCC(code uint32) uint32 {
+	{{- if .Renumbered}}
+	switch code {
+	{{- range .Renumbered}}
+	case {{.Code}}:
+		return {{.Const}}
+	{{- end}}
+	}
+	{{- end}}
+	return code
+}
+
+// {{.Prefix}}FourCCString returns the four characters of the fourcc
+// code of a {{.WlName}} value, as in "XR24".
+func {{.Prefix}}FourCCString(v uint32) string {
+	c := {{.Prefix}}FourCC(v)
+	return string([]byte{byte(c), byte(c >> 8), byte(c >> 16), byte(c >> 24)})
+}
+
+// {{.Prefix}}ParseFourCC returns the {{.WlName}} value whose fourcc
+// code is spelt s, and whether the protocol has one.
+func {{.Prefix}}ParseFourCC(s string) (uint32, bool) {
+	if len(s) != 4 {
+		return 0, false
+	}
+	switch v := {{.Prefix}}FromFourCC(uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24); v {
+	case {{.Values}}:
+		return v, true
+	}
+	return 0, false
+}
+
+// {{.Prefix}}BytesPerPixel returns how many bytes a pixel of a
+// {{.WlName}} value takes, a hint for working out strides, or 0 for
+// planar formats and those it does not know.
+func {{.Prefix}}BytesPerPixel(v uint32) int {
+	{{- if .Sizes}}
+	switch v {
+	{{- range .Sizes}}
+	case {{.Values}}:
+		return {{.Bytes}}
+	{{- end}}
+	}
+	{{- end}}
+	return 0
+}
+{{- end}}
+`
@@ -0,0 +1,1779 @@
+// Package generator turns a wayland protocol into Go client code for
+// the github.com/dkolbly/wl runtime.
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// Options controls what Generate produces.
+type Options struct {
+	Package  string // Go package name; "wl" for the core protocol
+	Unstable string // suffix to strip from interface names (e.g., v6)
+	Output   string // name of the generated Go file; defaults to Package + ".go"
+
+	// GoVersion is the oldest Go the generated code must build with,
+	// as in 1.21, which decides the language features it uses; 1.16 if
+	// empty.
+	GoVersion string
+
+	Source     string // where the protocol came from, recorded in the header
+	SourceData []byte // the protocol as read, for Reproducible and EmbedXML
+	Command    string // the command line, for Header templates
+
+	// runtime profile
+	Metrics    bool // instrument with Prometheus metrics
+	Middleware bool // route dispatch and sends through a middleware chain
+	Metadata   bool // generate introspection tables
+	// Binders generates helpers binding each global from the registry.
+	Binders bool
+	// EnumNames generates a function naming the values of each enum.
+	EnumNames bool
+	// MessageNames gives each proxy type methods naming its requests
+	// and events by opcode.
+	MessageNames bool
+	// Wait generates a method per event waiting for the next one.
+	Wait bool
+	// Filters generates a way to add handlers for only some events.
+	Filters bool
+	// Clone gives each event type a Clone method copying its arrays,
+	// for events kept past their handler.
+	Clone bool
+	// JSON gives each event type MarshalJSON and UnmarshalJSON
+	// methods, writing enums by name and proxies as object ids.
+	JSON bool
+	// GuardDestroyed has requests fail with ErrProxyDestroyed once a
+	// destructor request has been sent for the proxy, or its destructor
+	// event received.
+	GuardDestroyed bool
+	// Release gives the proxies of interfaces without a destructor
+	// request a Release method unregistering them locally.
+	Release bool
+	// TrackObjects counts the live proxies of each interface, for a
+	// DebugLiveObjects function reporting them.
+	TrackObjects bool
+	// Queue, if not zero, has each proxy queue up to that many events
+	// for its Poll method to deliver, rather than delivering them as
+	// they are dispatched.
+	Queue int
+	// Descriptor generates a Protocol value naming the protocol and
+	// the versions of its interfaces.
+	Descriptor bool
+
+	// DispatchTable, if not zero, dispatches the events of interfaces
+	// with at least that many through a table indexed by opcode.
+	DispatchTable int
+	// StrictDecode checks events against the protocol as they are
+	// decoded, reporting those that break it to DispatchErrorHandler
+	// rather than delivering them.
+	StrictDecode bool
+	// ValidateRequests checks the arguments of requests before they
+	// are sent, failing with a RequestError those that break the
+	// protocol.
+	ValidateRequests bool
+
+	NoDocs          bool   // leave out the comments taken from descriptions
+	Stats           bool   // sum up the protocol in a comment at the top
+	EmbedXML        bool   // embed the protocol XML in the package
+	DocGo           bool   // write a doc.go with the package comment
+	WireTables      bool   // write a WireFile describing every message's layout
+	Manifest        bool   // write a ManifestFile indexing the generated symbols
+	License         string // name of a file to copy the protocol copyright to
+	CopyrightHeader bool   // put the protocol copyright at the top of the Go file
+	Header          string // text/template source for a header on every Go file
+	SPDX            string // SPDX license expression for every Go file
+	Reproducible    bool   // record a hash of the source rather than its path
+	InputHash       string // recorded for the caller to tell if anything changed
+	Module          string // module path for a go.mod, if one is wanted
+	RuntimeVersion  string // version of the wl runtime the go.mod requires
+
+	// Imports are added to those of the Go file, each an import path
+	// or a name and a path, and Snippet is appended to it verbatim, for
+	// hand-written helpers that belong with the generated code.
+	Imports []string
+	Snippet string
+	// InterfaceSnippets are text/template sources by wayland interface
+	// name, each rendered over the interface's GoInterface and added
+	// after the interface's code.
+	InterfaceSnippets map[string]string
+
+	// Names, if not nil, resolves interfaces defined by the other
+	// protocols generated in the same run.
+	Names *NameTable
+
+	// Emitters produce further artifacts from the same model, after
+	// the client code and the built-in extras selected above.
+	Emitters []Emitter
+
+	// Warn, if not nil, is told about protocol features the generated
+	// code cannot fully represent.
+	Warn func(line int, msg string)
+	// WarnRule, if not nil, is told instead of Warn, along with an id
+	// for the kind of problem.
+	WarnRule func(rule string, line int, msg string)
+}
+
+// runtimeImport is the wl runtime package the generated code builds on,
+// which is also where the core protocol is generated to.
+const runtimeImport = "github.com/dkolbly/wl"
+
+// A File is one generated artifact, named relative to the directory of
+// the generated package.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// A Generator holds the state of generating one package.  It can be
+// used for several protocols in turn, but not concurrently; separate
+// Generators can run concurrently.
+type Generator struct {
+	opts   Options
+	out    bytes.Buffer
+	header *template.Template // opts.Header, once parsed
+
+	names      map[string]string             // wayland interface name to Go type
+	globals    map[string]bool               // interfaces to generate binders for
+	enums      map[string]protocol.Enum      // by qualified name, for StrictDecode
+	snippets   map[string]*template.Template // opts.InterfaceSnippets, once parsed
+	goMinor    int                           // of opts.GoVersion
+	wlPrefix   string                        // qualifier for wl runtime types
+	trimPrefix string
+	trimSuffix string
+}
+
+// Generate produces the Go package for prot.  The first File is the Go
+// code, named by opts.Output.  If that code does not gofmt, it is
+// returned unformatted along with the error, to help debug the
+// template that produced it.
+func Generate(prot *protocol.Protocol, opts Options) ([]File, error) {
+	return New(opts).Generate(prot)
+}
+
+// New returns a Generator producing code as described by opts.
+func New(opts Options) *Generator {
+	if opts.Package == "" {
+		opts.Package = "wl"
+	}
+	if opts.Output == "" {
+		opts.Output = opts.Package + ".go"
+	}
+	return &Generator{opts: opts, names: make(map[string]string)}
+}
+
+// NewInterface prepares iface for generation.  Interfaces it refers to
+// must already be named, as Generate does for the protocol's own.
+func (g *Generator) NewInterface(iface protocol.Interface) *GoInterface {
+	i := &GoInterface{
+		Name:        g.names[g.stripUnstable(iface.Name)],
+		WlInterface: iface,
+		WL:          g.wlPrefix,
+		Metrics:     g.opts.Metrics,
+		Middleware:  g.opts.Middleware,
+		DispatchTable: g.opts.DispatchTable > 0 &&
+			len(iface.Events) >= g.opts.DispatchTable,
+		Queue:  g.opts.Queue > 0,
+		Guard:  g.opts.GuardDestroyed,
+		Track:  g.opts.TrackObjects,
+		Global: g.globals[iface.Name],
+		Release: g.opts.Release && iface.Name != "wl_display" &&
+			!hasDestructor(iface),
+		gen: g,
+	}
+	if i.DispatchTable {
+		i.EventCount = strings.ToLower(i.Name[:1]) + i.Name[1:] + "EventCount"
+	}
+	return i
+}
+
+// Bytes returns the unformatted code generated so far.
+func (g *Generator) Bytes() []byte {
+	return g.out.Bytes()
+}
+
+// Generate produces the Go package for prot, as the package level
+// Generate does.
+func (g *Generator) Generate(prot *protocol.Protocol) (files []File, err error) {
+	opts := g.opts
+	if strings.ContainsAny(opts.SPDX, "\r\n") {
+		return nil, fmt.Errorf("SPDX expression must be a single line")
+	}
+	if opts.EmbedXML && protocol.IsIR(opts.Source, opts.SourceData) {
+		return nil, fmt.Errorf("embedding the protocol needs an XML source")
+	}
+	if g.goMinor, err = goMinorOf(opts.GoVersion); err != nil {
+		return nil, err
+	}
+	header, err := g.fileHeader(prot)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tErr, ok := r.(templateError)
+			if !ok {
+				panic(r)
+			}
+			files, err = nil, tErr.err
+		}
+	}()
+
+	g.out.Reset()
+	g.names = make(map[string]string)
+	g.wlPrefix = ""
+	g.trimPrefix = "wl_"
+	g.trimSuffix = ""
+	g.globals = make(map[string]bool)
+	g.enums = enumsOf(prot)
+	if g.snippets, err = parseSnippets(prot, opts.InterfaceSnippets); err != nil {
+		return nil, err
+	}
+	if opts.Binders {
+		for _, name := range Globals(prot) {
+			g.globals[name] = true
+		}
+	}
+
+	if prot.Name != "wayland" {
+		for _, inherit := range InheritedNames {
+			g.names[inherit] = "wl." + camelCase(inherit, "wl_")
+		}
+	}
+	if opts.Package != "wl" {
+		g.wlPrefix = "wl."
+		g.trimPrefix = opts.Package + "_"
+	}
+	if opts.Unstable != "" {
+		g.trimSuffix = "_" + opts.Unstable
+	}
+
+	var imports []string
+	if hasEvents(prot) || opts.TrackObjects {
+		imports = append(imports, "sync")
+	}
+	if hasEvents(prot) || usesDestroyed(prot, opts) {
+		imports = append(imports, "sync/atomic")
+	}
+	if opts.GuardDestroyed {
+		imports = append(imports, "errors")
+	}
+	if opts.Binders && len(g.globals) > 0 {
+		imports = append(imports, "fmt")
+	}
+	if opts.Package != "wl" {
+		imports = append(imports, runtimeImport)
+	}
+	imports = append(imports, g.importsFor(prot)...)
+
+	// required for request and event parameters
+	for _, iface := range prot.Interfaces {
+		if !strings.HasPrefix(iface.Name, g.trimPrefix) {
+			g.warnf("interface-prefix", iface.Line, "interface %s does not start with %q, so no prefix is stripped from its name",
+				iface.Name, g.trimPrefix)
+		}
+		if g.trimSuffix != "" && !strings.HasSuffix(iface.Name, g.trimSuffix) {
+			g.warnf("interface-suffix", iface.Line, "interface %s does not end with %q, so no suffix is stripped from its name",
+				iface.Name, g.trimSuffix)
+		}
+		g.caseAndRegister(g.stripUnstable(iface.Name))
+	}
+
+	g.out.WriteString(header)
+	if opts.CopyrightHeader && prot.Copyright != "" {
+		g.writeCopyrightHeader(prot)
+	}
+	fmt.Fprintf(&g.out, "// package %s acts as a client for the %s wayland protocol.\n\n",
+		opts.Package,
+		prot.Name)
+
+	g.writeProvenance(prot)
+	fmt.Fprintf(&g.out, "package %s\n", opts.Package)
+
+	if opts.Metrics {
+		if hasEvents(prot) {
+			imports = append(imports, "time")
+		}
+		imports = append(imports, "github.com/prometheus/client_golang/prometheus")
+	}
+	if opts.DispatchTable > 0 || opts.StrictDecode {
+		imports = append(imports, "fmt")
+	}
+	if opts.ValidateRequests {
+		imports = append(imports, "fmt")
+	}
+	if opts.JSON && hasEvents(prot) {
+		imports = append(imports, "encoding/json", "fmt", "strconv", "strings")
+	}
+	if opts.StrictDecode && hasLengths(prot) {
+		imports = append(imports, "bytes")
+	}
+	if opts.EnumNames {
+		imports = append(imports, enumNameImports(prot)...)
+	}
+	if opts.MessageNames {
+		imports = append(imports, "strconv")
+	}
+	if opts.Wait && hasEvents(prot) {
+		imports = append(imports, "context")
+		if g.goAtLeast(23) {
+			imports = append(imports, "iter")
+		}
+	}
+	fmt.Fprintf(&g.out, "import (\n")
+	imported := make(map[string]bool)
+	for _, imp := range imports {
+		if !imported[imp] {
+			imported[imp] = true
+			fmt.Fprintf(&g.out, "     %q\n", imp)
+		}
+	}
+	if opts.EmbedXML {
+		fmt.Fprintf(&g.out, "     _ \"embed\"\n")
+	}
+	for _, imp := range opts.Imports {
+		if f := strings.Fields(imp); len(f) == 2 {
+			fmt.Fprintf(&g.out, "     %s %q\n", f[0], f[1])
+		} else if !imported[imp] {
+			imported[imp] = true
+			fmt.Fprintf(&g.out, "     %q\n", imp)
+		}
+	}
+	fmt.Fprintf(&g.out, ")\n")
+
+	if opts.EmbedXML {
+		g.executeTemplate("EmbedTemplate", prot.Name)
+	}
+	if opts.Metrics {
+		g.executeTemplate("MetricsTemplate", opts.Package)
+	}
+	if opts.Middleware {
+		g.executeTemplate("MiddlewareTemplate", struct{ WL, Any string }{g.wlPrefix, g.anyType()})
+	}
+	if opts.DispatchTable > 0 || opts.StrictDecode {
+		g.executeTemplate("DispatchTableTemplate", g.wlPrefix)
+	}
+	if opts.StrictDecode {
+		g.executeTemplate("StrictDecodeTemplate", g.wlPrefix)
+		if hasLengths(prot) {
+			g.executeTemplate("LengthCheckTemplate", g.wlPrefix)
+		}
+	}
+	if opts.ValidateRequests {
+		g.executeTemplate("ValidateRequestsTemplate", nil)
+	}
+	if opts.GuardDestroyed {
+		g.executeTemplate("GuardTemplate", opts.Package)
+	}
+	if opts.TrackObjects {
+		g.executeTemplate("TrackTemplate", nil)
+	}
+	if opts.Queue > 0 && hasEvents(prot) {
+		g.executeTemplate("EventQueueTemplate", struct {
+			Size int
+			Max  bool // the builtin
+		}{opts.Queue, g.goAtLeast(21)})
+	}
+	if opts.Wait && hasEvents(prot) {
+		g.executeTemplate("EventStreamTemplate", nil)
+	}
+	if opts.JSON && hasEvents(prot) {
+		g.executeTemplate("JSONTemplate", g.jsonEnums(prot))
+	}
+
+	generated := g.interfaces(prot)
+	if len(generated) > 0 {
+		g.executeTemplate("AssertionsTemplate", generated)
+	}
+	if c := arrayConversionsOf(prot); c.Events || c.Requests {
+		c.Generic = g.goAtLeast(18)
+		g.executeTemplate("ArrayConversionsTemplate", c)
+	}
+	if geo := geometryOf(prot); geo.Point || geo.Rect {
+		g.executeTemplate("GeometryTemplate", geo)
+	}
+
+	if opts.Metadata {
+		g.executeTemplate("MetadataTemplate", metadataOf(generated))
+	}
+	if opts.Binders {
+		g.executeTemplate("BindersTemplate", g.bindersOf(prot))
+	}
+	if opts.Descriptor {
+		g.executeTemplate("DescriptorTemplate", descriptor{prot.Name, prot.Interfaces})
+	}
+	if opts.Snippet != "" {
+		fmt.Fprintf(&g.out, "\n%s\n", opts.Snippet)
+	}
+
+	src, err := format.Source(g.out.Bytes())
+	if err != nil {
+		return []File{{opts.Output, append([]byte(nil), g.out.Bytes()...)}},
+			fmt.Errorf("Cannot format %s: %s", opts.Output, err)
+	}
+	if err := checkDispatchers(opts.Output, src, generated); err != nil {
+		return []File{{opts.Output, src}}, err
+	}
+	files = append(files, File{opts.Output, src})
+
+	model := &Model{
+		Protocol:   prot,
+		Interfaces: generated,
+		Options:    opts,
+		Header:     header,
+	}
+	for _, e := range g.emitters() {
+		more, err := e.Emit(model)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, more...)
+	}
+	return files, nil
+}
+
+// TypeName returns the Go type generated for the named interface.
+func (o Options) TypeName(wlName string) string {
+	return o.GoName(strings.TrimSuffix(wlName, o.unstableSuffix()))
+}
+
+// GoName returns the Go form of a wayland name, as used for methods,
+// event types and constants.
+func (o Options) GoName(wlName string) string {
+	prefix := "wl_"
+	if o.Package != "" && o.Package != "wl" {
+		prefix = o.Package + "_"
+	}
+	return camelCase(wlName, prefix)
+}
+
+func (o Options) unstableSuffix() string {
+	if o.Unstable == "" {
+		return ""
+	}
+	return "_" + o.Unstable
+}
+
+// go types
+type (
+	GoInterface struct {
+		Name        string
+		WL          string
+		WlInterface protocol.Interface
+		Requests    []GoRequest
+		Events      []GoEvent
+		Enums       []GoEnum
+		Metrics     bool
+		Middleware  bool
+
+		// DispatchTable dispatches events through a table indexed
+		// by opcode rather than a switch, bounded by the constant
+		// named by EventCount.
+		DispatchTable bool
+		EventCount    string
+		// Queue holds events for Poll rather than delivering them.
+		Queue bool
+		// Guard refuses requests once a destructor has been sent.
+		Guard bool
+		// Track counts the proxies created and destroyed.
+		Track bool
+		// Release unregisters a proxy the protocol cannot destroy.
+		Release bool
+		// Global is bound from the registry, and remembers at what
+		// version.
+		Global bool
+
+		gen *Generator
+	}
+
+	GoRequest struct {
+		Name           string
+		WlName         string
+		IfaceName      string
+		WlIfaceName    string
+		Params         string
+		Returns        string
+		Args           string
+		HasNewId       bool
+		NewIdInterface string
+		Order          int
+		Docs           bool
+		Summary        string
+		Description    string
+		ArgDocs        string // what annotations say about the parameters
+		Metrics        bool
+		Send           string
+		Destructor     bool
+		Guard          bool
+		Track          bool
+		Validate       string // code checking the args before sending
+	}
+
+	GoEvent struct {
+		WL          string
+		Name        string
+		WlName      string
+		IfaceName   string
+		WlIfaceName string
+		PName       string
+		EName       string
+		Opcode      int
+		Args        []GoArg // in wire order
+		Fields      []GoArg // of the event struct, less args grouped into others
+		Metrics     bool
+		Wait        bool
+		Iter        bool // Wait's event streams are an iter.Seq
+		Filter      bool
+		Clone       bool
+		Queue       bool
+		Destructor  bool
+		Guard       bool
+		Track       bool
+	}
+
+	GoArg struct {
+		Name      string
+		Type      string
+		PName     string
+		BufMethod string
+		Convert   string // function converting what BufMethod decodes, if any
+		Decode    string // replaces decoding with BufMethod, if set
+		Comment   string
+	}
+
+	GoEnum struct {
+		Name        string
+		WlName      string
+		IfaceName   string
+		WlIfaceName string
+		BitField    bool
+		Entries     []GoEntry
+
+		NameFunc bool      // generate a function naming values
+		Distinct []GoEntry // the first entry with each value, in decimal
+	}
+
+	GoEntry struct {
+		Name   string
+		WlName string
+		Value  string
+	}
+)
+
+var (
+	wlTypes map[string]string = map[string]string{
+		"int":    "int32",
+		"uint":   "uint32",
+		"string": "string",
+		"fd":     "uintptr",
+		"fixed":  "float32",
+		"array":  "[]int32",
+	}
+
+	// sync with event.go
+	bufTypesMap map[string]string = map[string]string{
+		"int32":   "Int32()",
+		"uint32":  "Uint32()",
+		"string":  "String()",
+		"float32": "Float32()",
+		"[]int32": "Array()",
+		"uintptr": "FD()",
+	}
+)
+
+// hasDestructor reports whether iface has a destructor request, left
+// in the package.
+func hasDestructor(iface protocol.Interface) bool {
+	for _, req := range iface.Requests {
+		if req.Type == "destructor" && !req.Excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// usesDestroyed reports whether the code generated for prot with opts
+// sets the destroyed flag of its proxies: for GuardDestroyed, or for
+// TrackObjects once there is a destructor or a Release method.
+func usesDestroyed(prot *protocol.Protocol, opts Options) bool {
+	if opts.GuardDestroyed {
+		return true
+	}
+	if !opts.TrackObjects {
+		return false
+	}
+	for _, iface := range prot.Interfaces {
+		if hasDestructor(iface) || opts.Release && iface.Name != "wl_display" {
+			return true
+		}
+		for _, ev := range iface.Events {
+			if ev.Type == "destructor" && !ev.Excluded {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasEvents reports whether any interface of prot has events that are
+// not excluded.
+func hasEvents(prot *protocol.Protocol) bool {
+	for _, iface := range prot.Interfaces {
+		for _, ev := range iface.Events {
+			if !ev.Excluded {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enumNameImports returns the packages the enum name functions use:
+// strconv for any, strings for those of bitfields.
+func enumNameImports(prot *protocol.Protocol) []string {
+	var named, bitfield bool
+	for _, iface := range prot.Interfaces {
+		for _, enum := range iface.Enums {
+			for _, entry := range enum.Entries {
+				if _, err := strconv.ParseUint(entry.Value, 0, 32); err == nil {
+					named = true
+					bitfield = bitfield || enum.BitField
+				}
+			}
+		}
+	}
+	switch {
+	case bitfield:
+		return []string{"strconv", "strings"}
+	case named:
+		return []string{"strconv"}
+	}
+	return nil
+}
+
+// register names to map
+func (g *Generator) caseAndRegister(wlName string) string {
+	var orj string = wlName
+	wlName = g.camelCase(wlName)
+	g.names[orj] = wlName
+	return wlName
+}
+
+// templateError carries a template execution failure out of the
+// generation code to Generate, which returns it.
+type templateError struct {
+	err error
+}
+
+func (g *Generator) executeTemplate(name string, data interface{}) {
+	err := builtinTemplates.ExecuteTemplate(&g.out, name, data)
+	if err != nil {
+		panic(templateError{err})
+	}
+}
+
+// builtinTemplates are the templates the client code is made from,
+// parsed once rather than for every interface and message.
+var builtinTemplates = parseTemplates(map[string]string{
+	"InterfaceTypeTemplate":        ifaceTypeTemplate,
+	"InterfaceConstructorTemplate": ifaceConstructorTemplate,
+	"RequestTemplate":              requestTemplate,
+	"EventTemplate":                eventTemplate,
+	"AddRemoveHandlerTemplate":     ifaceAddRemoveHandlerTemplate,
+	"InterfaceDispatchTemplate":    ifaceDispatchTemplate,
+	"InterfaceEnumsTemplate":       ifaceEnums,
+	"EmbedTemplate":                embedTemplate,
+	"MetricsTemplate":              metricsTemplate,
+	"MiddlewareTemplate":           middlewareTemplate,
+	"MetadataTemplate":             metadataTemplate,
+	"DispatchTableTemplate":        dispatchTableTemplate,
+	"BindersTemplate":              bindersTemplate,
+	"MessageNamesTemplate":         messageNamesTemplate,
+	"AssertionsTemplate":           assertionsTemplate,
+	"ArrayConversionsTemplate":     arrayConversionsTemplate,
+	"GeometryTemplate":             geometryTemplate,
+	"DescriptorTemplate":           descriptorTemplate,
+	"EventQueueTemplate":           eventQueueTemplate,
+	"GuardTemplate":                guardTemplate,
+	"TrackTemplate":                trackTemplate,
+	"StrictDecodeTemplate":         strictDecodeTemplate,
+	"LengthCheckTemplate":          lengthCheckTemplate,
+	"ValidateRequestsTemplate":     validateRequestsTemplate,
+	"FourCCTemplate":               fourCCTemplate,
+	"JSONTemplate":                 jsonTemplate,
+	"EventJSONTemplate":            eventJSONTemplate,
+	"EventStreamTemplate":          eventStreamTemplate,
+})
+
+func parseTemplates(srcs map[string]string) *template.Template {
+	root := template.New("")
+	for name, src := range srcs {
+		template.Must(root.New(name).Parse(src))
+	}
+	return root
+}
+
+// An interfacePart is the code for one interface, generated apart
+// from the rest.
+type interfacePart struct {
+	gen      *Generator
+	iface    *GoInterface
+	warnings []partWarning
+	failed   interface{} // what the generation panicked with
+}
+
+type partWarning struct {
+	rule string
+	line int
+	msg  string
+}
+
+// interfaces generates the code for each interface concurrently, each
+// into a buffer of its own, and appends them in protocol order, so the
+// output and the order of the warnings do not depend on scheduling.
+func (g *Generator) interfaces(prot *protocol.Protocol) []GoInterface {
+	parts := make([]interfacePart, len(prot.Interfaces))
+	var wg sync.WaitGroup
+	for n, iface := range prot.Interfaces {
+		p := &parts[n]
+		p.gen = &Generator{
+			opts:       g.opts,
+			names:      g.names,
+			wlPrefix:   g.wlPrefix,
+			trimPrefix: g.trimPrefix,
+			trimSuffix: g.trimSuffix,
+			globals:    g.globals,
+			enums:      g.enums,
+			snippets:   g.snippets,
+			goMinor:    g.goMinor,
+		}
+		p.gen.opts.WarnRule = func(rule string, line int, msg string) {
+			p.warnings = append(p.warnings, partWarning{rule, line, msg})
+		}
+
+		wg.Add(1)
+		go func(iface protocol.Interface) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := r.(templateError); !ok {
+						panic(r)
+					}
+					p.failed = r
+				}
+			}()
+			goIface := p.gen.NewInterface(iface)
+			goIface.ProcessEvents()
+			goIface.Constructor()
+			goIface.ProcessRequests()
+			goIface.ProcessEnums()
+			if t := p.gen.snippets[iface.Name]; t != nil {
+				p.gen.out.WriteString("\n")
+				if err := t.Execute(&p.gen.out, goIface); err != nil {
+					panic(templateError{err})
+				}
+			}
+			p.iface = goIface
+		}(iface)
+	}
+	wg.Wait()
+
+	generated := make([]GoInterface, 0, len(parts))
+	for _, p := range parts {
+		for _, w := range p.warnings {
+			g.warnf(w.rule, w.line, "%s", w.msg)
+		}
+		if p.failed != nil {
+			panic(p.failed)
+		}
+		g.out.Write(p.gen.out.Bytes())
+		goIface := *p.iface
+		goIface.gen = g
+		generated = append(generated, goIface)
+	}
+	return generated
+}
+
+func (g *Generator) warnf(rule string, line int, format string, args ...interface{}) {
+	switch {
+	case g.opts.WarnRule != nil:
+		g.opts.WarnRule(rule, line, fmt.Sprintf(format, args...))
+	case g.opts.Warn != nil:
+		g.opts.Warn(line, fmt.Sprintf(format, args...))
+	}
+}
+
+func (i *GoInterface) Constructor() {
+	i.gen.executeTemplate("InterfaceTypeTemplate", i)
+	i.gen.executeTemplate("InterfaceConstructorTemplate", i)
+	if i.gen.opts.MessageNames {
+		i.gen.executeTemplate("MessageNamesTemplate", i)
+	}
+}
+
+func (i *GoInterface) ProcessRequests() {
+	for order, wlReq := range i.WlInterface.Requests {
+		if wlReq.Excluded {
+			continue
+		}
+		var (
+			returns         []string
+			params          []string
+			sendRequestArgs []string // for sendRequest
+		)
+
+		req := GoRequest{
+			Name:        i.gen.messageName(wlReq.Name, wlReq.Annotation),
+			WlName:      wlReq.Name,
+			IfaceName:   i.gen.stripUnstable(i.Name),
+			WlIfaceName: i.WlInterface.Name,
+			Order:       order,
+			Docs:        !i.gen.opts.NoDocs,
+			Summary:     wlReq.Description.Summary,
+			Description: reflow(wlReq.Description.Text),
+			ArgDocs:     argDocs(wlReq.Args),
+			Metrics:     i.Metrics,
+			Send:        "p.Context().SendRequest",
+			Destructor:  wlReq.Type == "destructor",
+			Guard:       i.Guard,
+			Track:       i.Track,
+		}
+		if i.Middleware {
+			req.Send = "sendChain"
+		}
+		if wlReq.Description.Summary == "" {
+			i.gen.warnf("missing-description", wlReq.Line, "request %s.%s has no description", i.WlInterface.Name, wlReq.Name)
+		}
+
+		grouped := make(map[string]bool)
+		values := make(map[string]string) // Go expression of each arg, for ValidateRequests
+		for _, arg := range wlReq.Args {
+			name := argName(arg)
+			values[arg.Name] = name
+			if group, field := groupOf(wlReq.Annotation, arg.Name); group != "" {
+				if !grouped[group] {
+					grouped[group] = true
+					params = append(params, paramOf(group)+" "+group)
+				}
+				sendRequestArgs = append(sendRequestArgs, paramOf(group)+"."+field)
+				values[arg.Name] = paramOf(group) + "." + field
+			} else if arg.Type == "new_id" {
+				if arg.Interface != "" {
+					newIdIface := i.gen.names[i.gen.stripUnstable(arg.Interface)]
+					req.NewIdInterface = newIdIface
+					sendRequestArgs = append(sendRequestArgs, i.gen.wlPrefix+"Proxy(ret)")
+					req.HasNewId = true
+
+					returns = append(returns, "*"+newIdIface)
+					delete(values, arg.Name)
+				} else { //special for registry.Bind
+					sendRequestArgs = append(sendRequestArgs, "iface")
+					sendRequestArgs = append(sendRequestArgs, "version")
+					sendRequestArgs = append(sendRequestArgs, name)
+
+					params = append(params, "iface string")
+					params = append(params, "version uint32")
+					params = append(params, fmt.Sprintf("%s %sProxy", name, i.gen.wlPrefix))
+				}
+			} else if arg.Type == "object" && arg.Interface != "" {
+				paramTypeName := i.gen.names[i.gen.stripUnstable(arg.Interface)]
+				params = append(params, fmt.Sprintf("%s *%s", name, paramTypeName))
+				sendRequestArgs = append(sendRequestArgs, name)
+				/*} else if arg.Type == "uint" && arg.Enum != "" {
+					params = append(params, fmt.Sprintf("%s %s", arg.Name, enumArgName(ifaceName, arg.Enum)))
+				}*/
+			} else if unsigned(arg) {
+				sendRequestArgs = append(sendRequestArgs, i.gen.convertTo("int32")+"("+name+")")
+				params = append(params, name+" []uint32")
+			} else {
+				if _, ok := wlTypes[arg.Type]; !ok {
+					i.gen.warnf("unmapped-type", arg.Line, "arg %s of %s.%s has type %s, which has no Go type mapping",
+						arg.Name, i.WlInterface.Name, wlReq.Name, arg.Type)
+				}
+				sendRequestArgs = append(sendRequestArgs, name)
+				params = append(params, fmt.Sprintf("%s %s", name, wlTypes[arg.Type]))
+			}
+		}
+
+		req.Params = strings.Join(params, ",")
+		if i.gen.opts.ValidateRequests {
+			req.Validate = i.gen.validateRequest(i.WlInterface.Name, wlReq, values, req.HasNewId)
+		}
+
+		if len(sendRequestArgs) > 0 {
+			req.Args = "," + strings.Join(sendRequestArgs, ",")
+		}
+
+		if len(returns) > 0 { // ( ret , error )
+			req.Returns = fmt.Sprintf("(%s , error)", strings.Join(returns, ","))
+		} else { // returns only error
+			req.Returns = "error"
+		}
+
+		i.gen.executeTemplate("RequestTemplate", req)
+		i.Requests = append(i.Requests, req)
+	}
+}
+
+func (i *GoInterface) ProcessEvents() {
+	// Event struct types
+	for opcode, wlEv := range i.WlInterface.Events {
+		if wlEv.Excluded {
+			continue // and dropped by Dispatch
+		}
+		ev := GoEvent{
+			Name:        i.gen.messageName(wlEv.Name, wlEv.Annotation),
+			WlName:      wlEv.Name,
+			PName:       snakeCase(wlEv.Name),
+			Opcode:      opcode,
+			IfaceName:   i.Name,
+			WlIfaceName: i.WlInterface.Name,
+			WL:          i.gen.wlPrefix,
+			Metrics:     i.Metrics,
+			Wait:        i.gen.opts.Wait,
+			Iter:        i.gen.goAtLeast(23),
+			Filter:      i.gen.opts.Filters,
+			Clone:       i.gen.opts.Clone,
+			Queue:       i.Queue,
+			Destructor:  wlEv.Type == "destructor",
+			Guard:       i.Guard,
+			Track:       i.Track,
+		}
+		ev.EName = i.Name + ev.Name
+		evJSON := jsonEvent{Type: ev.EName + "Event"}
+
+		grouped := make(map[string]bool)
+		for _, arg := range wlEv.Args {
+			goarg := GoArg{
+				Name:    i.gen.fieldName(arg),
+				PName:   snakeCase(arg.Name),
+				Comment: argComment(arg),
+			}
+			group, field := groupOf(wlEv.Annotation, arg.Name)
+			if group != "" {
+				goarg.Name = group + "." + field
+				if !grouped[group] {
+					grouped[group] = true
+					ev.Fields = append(ev.Fields, GoArg{Name: group, Type: group})
+				}
+			}
+			if t, ok := wlTypes[arg.Type]; ok { // if basic type
+				bufMethod, ok := bufTypesMap[t]
+				if !ok {
+					i.gen.warnf("no-decoder", arg.Line, "arg %s of %s.%s has Go type %s, which has no event decoder",
+						arg.Name, i.WlInterface.Name, wlEv.Name, t)
+				} else {
+					goarg.BufMethod = bufMethod
+				}
+				/*
+					if arg.Type == "uint" && arg.Enum != "" { // enum type
+						enumTypeName := ifaceName + i.gen.camelCase(arg.Enum)
+						fmt.Fprintf(&eventBuffer, "%s %s\n", i.gen.camelCase(arg.Name), enumTypeName)
+					} else {
+						fmt.Fprintf(&eventBuffer, "%s %s\n", i.gen.camelCase(arg.Name), t)
+					}*/
+				goarg.Type = t
+				if unsigned(arg) {
+					goarg.Type, goarg.Convert = "[]uint32", i.gen.convertTo("uint32")
+				}
+			} else { // interface type
+				if (arg.Type == "object" || arg.Type == "new_id") && arg.Interface != "" {
+					t = "*" + i.gen.names[i.gen.stripUnstable(arg.Interface)]
+					goarg.BufMethod = fmt.Sprintf("Proxy(p.Context()).(%s)", t)
+				} else {
+					t = i.gen.wlPrefix + "Proxy"
+					goarg.BufMethod = "Proxy(p.Context())"
+				}
+				goarg.Type = t
+			}
+
+			if i.gen.opts.StrictDecode {
+				goarg.Decode = i.gen.strictDecode(i.WlInterface.Name, wlEv.Name, arg, goarg)
+			}
+			ev.Args = append(ev.Args, goarg)
+			if group == "" {
+				ev.Fields = append(ev.Fields, goarg)
+			}
+			evJSON.Fields = append(evJSON.Fields, i.gen.jsonField(i.WlInterface.Name, arg, goarg))
+		}
+
+		i.gen.executeTemplate("EventTemplate", ev)
+		if i.gen.opts.JSON {
+			i.gen.executeTemplate("EventJSONTemplate", evJSON)
+		}
+		i.gen.executeTemplate("AddRemoveHandlerTemplate", ev)
+
+		i.Events = append(i.Events, ev)
+	}
+
+	if len(i.Events) > 0 {
+		i.gen.executeTemplate("InterfaceDispatchTemplate", i)
+	}
+}
+
+func (i *GoInterface) ProcessEnums() {
+	// Enums - Constants
+	for _, wlEnum := range i.WlInterface.Enums {
+		goEnum := GoEnum{
+			Name:        i.gen.camelCase(wlEnum.Name),
+			WlName:      wlEnum.Name,
+			IfaceName:   i.Name,
+			WlIfaceName: i.WlInterface.Name,
+			BitField:    wlEnum.BitField,
+			NameFunc:    i.gen.opts.EnumNames,
+		}
+
+		seen := make(map[uint64]bool)
+		for _, wlEntry := range wlEnum.Entries {
+			goEntry := GoEntry{
+				Name:   i.gen.camelCase(wlEntry.Name),
+				WlName: wlEntry.Name,
+				Value:  wlEntry.Value,
+			}
+			goEnum.Entries = append(goEnum.Entries, goEntry)
+
+			v, err := strconv.ParseUint(wlEntry.Value, 0, 32)
+			if err != nil || seen[v] {
+				continue
+			}
+			seen[v] = true
+			goEntry.Value = strconv.FormatUint(v, 10)
+			goEnum.Distinct = append(goEnum.Distinct, goEntry)
+		}
+		if goEnum.NameFunc && len(goEnum.Distinct) == 0 {
+			goEnum.NameFunc = false
+		}
+
+		i.gen.executeTemplate("InterfaceEnumsTemplate", goEnum)
+		if a := wlEnum.Annotation; a != nil && a.FourCC {
+			i.gen.executeTemplate("FourCCTemplate", i.gen.fourCCOf(goEnum, wlEnum))
+		}
+		i.Enums = append(i.Enums, goEnum)
+	}
+}
+
+/*
+func enumArgName(ifaceName, enumName string) string {
+	if strings.Index(enumName, ".") == -1 {
+		return ifaceName + CamelCase(enumName)
+	}
+
+	parts := strings.Split(enumName, ".")
+	if len(parts) != 2 {
+		log.Fatalf("enum args must be \"interface.enum\" format: we get %s",enumName)
+	}
+	return CamelCase(parts[0]) + CamelCase(parts[1])
+}
+*/
+
+func (g *Generator) camelCase(wlName string) string {
+	return camelCase(wlName, g.trimPrefix)
+}
+
+func camelCase(wlName, trimPrefix string) string {
+	wlName = strings.TrimPrefix(wlName, trimPrefix)
+
+	// replace all "_" chars to " " chars
+	wlName = strings.Replace(wlName, "_", " ", -1)
+
+	// Capitalize first chars
+	wlName = strings.Title(wlName)
+
+	// remove all spaces
+	wlName = strings.Replace(wlName, " ", "", -1)
+
+	return wlName
+}
+
+func snakeCase(wlName string) string {
+	if strings.HasPrefix(wlName, "wl_") {
+		wlName = strings.TrimPrefix(wlName, "wl_")
+	}
+
+	// replace all "_" chars to " " chars
+	wlName = strings.Replace(wlName, "_", " ", -1)
+	parts := strings.Split(wlName, " ")
+	for i, p := range parts {
+		if i == 0 {
+			continue
+		}
+		parts[i] = strings.Title(p)
+	}
+
+	return strings.Join(parts, "")
+}
+
+// templates
+var (
+	ifaceTypeTemplate = `
+type {{.Name}} struct {
+	{{.WL}}BaseProxy
+	{{- if or .Guard .Track}}
+	destroyed int32 // set once a destructor is sent or received, or p is released
+	{{- end}}
+	{{- if .Global}}
+	version uint32 // as bound
+	{{- end}}
+	{{- if gt (len .Events) 0 }}
+	{{- if .Queue}}
+	queue eventQueue
+	{{- end}}
+	mu sync.RWMutex
+	// each ...Count is the length of ...Handlers, kept so that
+	// Dispatch need not lock when there are no handlers
+	{{- end}}
+
+	{{- range .Events}}
+	{{.PName}}Handlers []{{.EName}}Handler
+	{{.PName}}Count    int32
+	{{- end}}
+}
+`
+	ifaceConstructorTemplate = `
+{{- if .Global}}
+// Version returns the version p was bound at.
+func (p *{{.Name}}) Version() uint32 {
+	return p.version
+}
+{{end}}
+func New{{.Name}}(ctx *{{.WL}}Context) *{{.Name}} {
+	ret := new({{.Name}})
+	ctx.Register(ret)
+	{{- if .Track}}
+	trackObject("{{.WlInterface.Name}}", 1)
+	{{- end}}
+	return ret
+}
+{{- if .Release}}
+
+// Release unregisters p from its Context without telling the
+// compositor, since {{.WlInterface.Name}} has no destructor request, so that
+// the Context no longer holds on to it.  It is safe only once the
+// compositor is done with the object, as it is with a wl_callback after
+// its done event: events sent to p after Release are dropped.
+func (p *{{.Name}}) Release() {
+	{{- if or .Guard .Track}}
+	if !atomic.CompareAndSwapInt32(&p.destroyed, 0, 1) {
+		return
+	}
+	{{- end}}
+	p.Context().Unregister(p.Id())
+	{{- if .Track}}
+	trackObject("{{.WlInterface.Name}}", -1)
+	{{- end}}
+}
+{{- end}}
+`
+	// The runtime has to take the generated types as its Proxy, and
+	// those with events as its Dispatcher; saying so here makes a
+	// runtime that no longer does fail to build at these lines.
+	assertionsTemplate = `
+// Every type is a proxy of the runtime, and those with events its
+// dispatcher; if the runtime disagrees, this is where the build fails.
+var (
+{{- range .}}
+	_ {{.WL}}Proxy = (*{{.Name}})(nil)
+	{{- if .Events}}
+	_ {{.WL}}Dispatcher = (*{{.Name}})(nil)
+	{{- end}}
+{{- end}}
+)
+`
+	messageNamesTemplate = `
+{{- $wlName := .WlInterface.Name}}
+var requestNames{{.Name}} = [...]string{
+	{{- range .WlInterface.Requests}}
+	"{{$wlName}}.{{.Name}}",
+	{{- end}}
+}
+
+var eventNames{{.Name}} = [...]string{
+	{{- range .WlInterface.Events}}
+	"{{$wlName}}.{{.Name}}",
+	{{- end}}
+}
+
+// RequestName returns the name of the {{$wlName}} request with the
+// given opcode, for logging.
+func (p *{{.Name}}) RequestName(opcode uint32) string {
+	if opcode < uint32(len(requestNames{{.Name}})) {
+		return requestNames{{.Name}}[opcode]
+	}
+	return "{{$wlName}}.request" + strconv.FormatUint(uint64(opcode), 10)
+}
+
+// EventName returns the name of the {{$wlName}} event with the given
+// opcode, for logging.
+func (p *{{.Name}}) EventName(opcode uint32) string {
+	if opcode < uint32(len(eventNames{{.Name}})) {
+		return eventNames{{.Name}}[opcode]
+	}
+	return "{{$wlName}}.event" + strconv.FormatUint(uint64(opcode), 10)
+}
+`
+	ifaceAddRemoveHandlerTemplate = `
+func (p *{{.IfaceName}}) Add{{.Name}}Handler(h {{.EName}}Handler) {
+	if h != nil {
+		p.mu.Lock()
+		p.{{.PName}}Handlers = append(p.{{.PName}}Handlers , h)
+		atomic.StoreInt32(&p.{{.PName}}Count, int32(len(p.{{.PName}}Handlers)))
+		p.mu.Unlock()
+	}
+}
+
+func (p *{{.IfaceName}}) Remove{{.Name}}Handler(h {{.EName}}Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i , e := range p.{{.PName}}Handlers {
+		{{- if .Filter}}
+		if f, ok := e.(*filtered{{.EName}}Handler); ok && f.h == h {
+			e = h
+		}
+		{{- end}}
+		if e == h {
+			p.{{.PName}}Handlers = append(p.{{.PName}}Handlers[:i] , p.{{.PName}}Handlers[i+1:]...)
+			atomic.StoreInt32(&p.{{.PName}}Count, int32(len(p.{{.PName}}Handlers)))
+			break
+		}
+	}
+}
+{{- if .Filter}}
+
+type filtered{{.EName}}Handler struct {
+	pred func({{.EName}}Event) bool
+	h    {{.EName}}Handler
+}
+
+func (f *filtered{{.EName}}Handler) Handle{{.EName}}(ev {{.EName}}Event) {
+	if f.pred(ev) {
+		f.h.Handle{{.EName}}(ev)
+	}
+}
+
+// Add{{.Name}}HandlerFiltered adds h to be called only for the {{.WlName}}
+// events pred accepts.  Remove{{.Name}}Handler(h) removes it again.
+func (p *{{.IfaceName}}) Add{{.Name}}HandlerFiltered(pred func({{.EName}}Event) bool, h {{.EName}}Handler) {
+	if pred == nil {
+		p.Add{{.Name}}Handler(h)
+	} else if h != nil {
+		p.Add{{.Name}}Handler(&filtered{{.EName}}Handler{pred, h})
+	}
+}
+{{- end}}
+{{- if .Wait}}
+
+type wait{{.EName}} chan {{.EName}}Event
+
+func (w wait{{.EName}}) Handle{{.EName}}(ev {{.EName}}Event) {
+	select {
+	case w <- ev:
+	default:
+	}
+}
+
+// Wait{{.Name}} waits for the next {{.WlName}} event, or for ctx to be
+// done.  Events must be dispatched by some other goroutine meanwhile.
+func (p *{{.IfaceName}}) Wait{{.Name}}(ctx context.Context) ({{.EName}}Event, error) {
+	w := make(wait{{.EName}}, 1)
+	p.Add{{.Name}}Handler(w)
+	defer p.Remove{{.Name}}Handler(w)
+	select {
+	case ev := <-w:
+		return ev, nil
+	case <-ctx.Done():
+		return {{.EName}}Event{}, ctx.Err()
+	}
+}
+{{- if .Iter}}
+
+// {{.Name}}Events returns the {{.WlName}} events dispatched while a loop
+// ranges over them, until ctx is done or the loop stops.  Events must
+// be dispatched by some other goroutine meanwhile; a loop falling more
+// than eventStreamSize events behind misses the rest.
+func (p *{{.IfaceName}}) {{.Name}}Events(ctx context.Context) iter.Seq[{{.EName}}Event] {
+	return func(yield func({{.EName}}Event) bool) {
+		w := make(wait{{.EName}}, eventStreamSize)
+		p.Add{{.Name}}Handler(w)
+		defer p.Remove{{.Name}}Handler(w)
+		for {
+			select {
+			case ev := <-w:
+				if !yield(ev) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+{{- else}}
+
+// {{.Name}}Events returns a channel of the {{.WlName}} events dispatched
+// from now on, closed once ctx is done.  Events must be dispatched by
+// some other goroutine meanwhile; a reader falling more than
+// eventStreamSize events behind misses the rest.
+func (p *{{.IfaceName}}) {{.Name}}Events(ctx context.Context) <-chan {{.EName}}Event {
+	w := make(wait{{.EName}}, eventStreamSize)
+	p.Add{{.Name}}Handler(w)
+	events := make(chan {{.EName}}Event)
+	go func() {
+		defer close(events)
+		defer p.Remove{{.Name}}Handler(w)
+		for {
+			select {
+			case ev := <-w:
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+{{- end}}
+{{- end}}
+`
+
+	requestTemplate = `
+{{if .Docs}}// {{.Name}} will {{.Summary}}.
+//
+{{.Description}}{{with .ArgDocs}}//
+{{.}}{{end}}{{else}}{{.ArgDocs}}{{end}}func (p *{{.IfaceName}}) {{.Name}}({{.Params}}) {{.Returns}} {
+	{{- with .Validate}}
+	{{.}}
+	{{- end}}
+	{{- if .Guard}}
+	{{- if .Destructor}}
+	if !atomic.CompareAndSwapInt32(&p.destroyed, 0, 1) {
+	{{- else}}
+	if atomic.LoadInt32(&p.destroyed) != 0 {
+	{{- end}}
+		return {{if .HasNewId}}nil, {{end}}ErrProxyDestroyed
+	}
+	{{- end}}
+	{{- if .Metrics}}
+	metricRequestsSent.WithLabelValues("{{.WlIfaceName}}", "{{.WlName}}").Inc()
+	{{- end}}
+	{{- if .HasNewId}}
+	ret := New{{.NewIdInterface}}(p.Context())
+	return ret , {{.Send}}(p,{{.Order}}{{.Args}})
+	{{- else if and .Track .Destructor}}
+	err := {{.Send}}(p,{{.Order}}{{.Args}})
+	{{- if .Guard}}
+	if err == nil {
+	{{- else}}
+	if err == nil && atomic.CompareAndSwapInt32(&p.destroyed, 0, 1) {
+	{{- end}}
+		trackObject("{{.WlIfaceName}}", -1)
+	}
+	return err
+	{{- else}}
+	return {{.Send}}(p,{{.Order}}{{.Args}})
+	{{- end}}
+}
+`
+
+	eventTemplate = `
+type {{.IfaceName}}{{.Name}}Event struct {
+	{{- range .Fields }}
+	{{.Name}} {{.Type}}{{with .Comment}} // {{.}}{{end}}
+	{{- end }}
+}
+
+type {{.IfaceName}}{{.Name}}Handler interface {
+    Handle{{.EName}}({{.EName}}Event)
+}
+{{- if .Clone}}
+
+// Clone returns a copy of ev sharing no arrays with it, to keep past
+// the handler it was given to.  Proxies and fds are not copied.
+func (ev {{.IfaceName}}{{.Name}}Event) Clone() {{.IfaceName}}{{.Name}}Event {
+	{{- range .Fields}}
+	{{- if eq .Type "[]int32" "[]uint32"}}
+	ev.{{.Name}} = append(ev.{{.Name}}[:0:0], ev.{{.Name}}...)
+	{{- end}}
+	{{- end}}
+	return ev
+}
+{{- end}}
+`
+
+	ifaceDispatchTemplate = `
+{{- define "EventDispatch"}}
+		{{- if and .Destructor .Track}}
+		if atomic.CompareAndSwapInt32(&p.destroyed, 0, 1) {
+			trackObject("{{.WlIfaceName}}", -1)
+		}
+		{{- else if and .Destructor .Guard}}
+		atomic.StoreInt32(&p.destroyed, 1)
+		{{- end}}
+		{{- if .Metrics}}
+		metricEventsDispatched.WithLabelValues("{{.WlIfaceName}}", "{{.WlName}}").Inc()
+		{{- end}}
+		if atomic.LoadInt32(&p.{{.PName}}Count) > 0 {
+			ev := {{.IfaceName}}{{.Name}}Event{}
+			{{- range .Args}}
+			{{- if .Decode}}
+			{{.Decode}}
+			{{- else}}
+			ev.{{.Name}} = {{.Decoded}}
+			{{- end}}
+			{{- end}}
+			{{- if .Queue}}
+			p.queue.push(func() {
+			{{- end}}
+			{{- if .Metrics}}
+			start := time.Now()
+			{{- end}}
+			p.mu.RLock()
+			for _, h := range p.{{.PName}}Handlers {
+				h.Handle{{.EName}}(ev)
+			}
+			p.mu.RUnlock()
+			{{- if .Metrics}}
+			metricHandlerDuration.WithLabelValues("{{.WlIfaceName}}", "{{.WlName}}").Observe(time.Since(start).Seconds())
+			{{- end}}
+			{{- if .Queue}}
+			})
+			{{- end}}
+		}
+{{- end}}
+{{- if .DispatchTable}}
+// {{.EventCount}} is the number of events of {{.WlInterface.Name}}, one more
+// than the highest opcode.
+const {{.EventCount}} = {{len .WlInterface.Events}}
+
+// eventTable{{.Name}} decodes and delivers each event of {{.WlInterface.Name}}, by opcode.
+var eventTable{{.Name}} = [{{.EventCount}}]func(p *{{.Name}}, event *{{.WL}}Event){
+	{{- range .Events}}
+	{{.Opcode}}: func(p *{{.IfaceName}}, event *{{.WL}}Event) {
+		{{- template "EventDispatch" .}}
+	},
+	{{- end}}
+}
+{{end}}
+{{- if .Middleware}}
+func (p *{{.Name}}) Dispatch(event *{{.WL}}Event) {
+	dispatchChain(p, event)
+}
+
+func (p *{{.Name}}) dispatch(event *{{.WL}}Event) {
+{{- else}}
+func (p *{{.Name}}) Dispatch(event *{{.WL}}Event) {
+{{- end}}
+	{{- if .DispatchTable}}
+	if event.Opcode >= {{.EventCount}} {
+		if DispatchErrorHandler != nil {
+			DispatchErrorHandler(p, &InvalidOpcodeError{"{{.WlInterface.Name}}", event.Opcode})
+		}
+		return
+	}
+	{{- if lt (len .Events) (len .WlInterface.Events)}}
+	if f := eventTable{{.Name}}[event.Opcode]; f != nil {
+		f(p, event)
+	}
+	{{- else}}
+	eventTable{{.Name}}[event.Opcode](p, event)
+	{{- end}}
+	{{- else}}
+	switch event.Opcode {
+	{{- range $i , $event := .Events }}
+	case {{$event.Opcode}}:
+		{{- template "EventDispatch" $event}}
+	{{- end}}
+	}
+	{{- end}}
+}
+{{- if .Queue}}
+
+// Poll delivers the events queued for p to its handlers, in the order
+// they arrived, and returns how many there were.
+func (p *{{.Name}}) Poll() int {
+	return p.queue.poll()
+}
+
+// Flush drops the events queued for p.
+func (p *{{.Name}}) Flush() {
+	p.queue.flush()
+}
+{{- end}}
+`
+	guardTemplate = `
+// ErrProxyDestroyed is returned by requests on a proxy a destructor
+// request has already been sent for.
+var ErrProxyDestroyed = errors.New("{{.}}: request on a destroyed proxy")
+`
+	trackTemplate = `
+// liveObjects counts, by interface, the proxies created and not yet
+// destroyed.
+var liveObjects = struct {
+	sync.Mutex
+	count map[string]int
+}{count: make(map[string]int)}
+
+func trackObject(iface string, delta int) {
+	liveObjects.Lock()
+	liveObjects.count[iface] += delta
+	liveObjects.Unlock()
+}
+
+// DebugLiveObjects reports, by interface, how many proxies this package
+// has created and not yet destroyed by a destructor request or event,
+// or released, to help find the objects an application leaks.  Interfaces with none
+// live are left out; a negative count means more destructors were sent
+// than proxies created.
+func DebugLiveObjects() map[string]int {
+	liveObjects.Lock()
+	defer liveObjects.Unlock()
+	live := make(map[string]int)
+	for iface, n := range liveObjects.count {
+		if n != 0 {
+			live[iface] = n
+		}
+	}
+	return live
+}
+`
+	eventQueueTemplate = `
+// eventQueueSize is how many events a proxy queues before it drops
+// the oldest.
+const eventQueueSize = {{.Size}}
+
+// eventQueue holds the delivery of decoded events until Poll.
+type eventQueue struct {
+	mu      sync.Mutex
+	pending []func()
+}
+
+func (q *eventQueue) push(deliver func()) {
+	q.mu.Lock()
+	{{- if .Max}}
+	q.pending = append(q.pending[max(0, len(q.pending)-eventQueueSize+1):], deliver)
+	{{- else}}
+	if len(q.pending) == eventQueueSize {
+		q.pending = append(q.pending[:0], q.pending[1:]...)
+	}
+	q.pending = append(q.pending, deliver)
+	{{- end}}
+	q.mu.Unlock()
+}
+
+func (q *eventQueue) poll() int {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	for _, deliver := range pending {
+		deliver()
+	}
+	return len(pending)
+}
+
+func (q *eventQueue) flush() {
+	q.mu.Lock()
+	q.pending = nil
+	q.mu.Unlock()
+}
+`
+	dispatchTableTemplate = `
+// InvalidOpcodeError is an event whose opcode the interface of the
+// proxy it is addressed to does not have.
+type InvalidOpcodeError struct {
+	Interface string
+	Opcode    uint32
+}
+
+func (e *InvalidOpcodeError) Error() string {
+	return fmt.Sprintf("%s has no event with opcode %d", e.Interface, e.Opcode)
+}
+
+// DispatchErrorHandler, if not nil, is told about events that cannot
+// be dispatched.  By default they are dropped.
+var DispatchErrorHandler func(p {{.}}Proxy, err error)
+`
+	metricsTemplate = `
+var (
+	metricRequestsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wayland",
+		Subsystem: "{{.}}",
+		Name:      "requests_sent_total",
+		Help:      "Number of requests sent, by interface and request.",
+	}, []string{"interface", "request"})
+
+	metricEventsDispatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wayland",
+		Subsystem: "{{.}}",
+		Name:      "events_dispatched_total",
+		Help:      "Number of events dispatched, by interface and event.",
+	}, []string{"interface", "event"})
+
+	metricHandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "wayland",
+		Subsystem: "{{.}}",
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent in event handlers, by interface and event.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"interface", "event"})
+)
+
+// RegisterMetrics registers the collectors for this package with reg.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		metricRequestsSent,
+		metricEventsDispatched,
+		metricHandlerDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`
+
+	middlewareTemplate = `
+// DispatchFunc delivers an event to the proxy it is addressed to.
+type DispatchFunc func(p {{.WL}}Proxy, event *{{.WL}}Event)
+
+// SendFunc sends a request on behalf of a proxy.
+type SendFunc func(p {{.WL}}Proxy, opcode uint32, args ...{{.Any}}) error
+
+var (
+	dispatchChain DispatchFunc = dispatchEvent
+	sendChain     SendFunc     = sendRequest
+)
+
+type eventDispatcher interface {
+	dispatch(event *{{.WL}}Event)
+}
+
+func dispatchEvent(p {{.WL}}Proxy, event *{{.WL}}Event) {
+	p.(eventDispatcher).dispatch(event)
+}
+
+func sendRequest(p {{.WL}}Proxy, opcode uint32, args ...{{.Any}}) error {
+	return p.Context().SendRequest(p, opcode, args...)
+}
+
+// UseDispatch wraps event dispatch for every proxy in this package with mw.
+// The most recently added middleware runs first.  It is not safe to call
+// UseDispatch while events are being dispatched.
+func UseDispatch(mw func(next DispatchFunc) DispatchFunc) {
+	dispatchChain = mw(dispatchChain)
+}
+
+// UseSend wraps request sends for every proxy in this package with mw.
+// The most recently added middleware runs first.  It is not safe to call
+// UseSend while requests are being sent.
+func UseSend(mw func(next SendFunc) SendFunc) {
+	sendChain = mw(sendChain)
+}
+`
+
+	ifaceEnums = `
+const (
+	{{- $ifaceName := .IfaceName }}
+	{{- $enumName := .Name }}
+	{{- range .Entries}}
+	{{$ifaceName}}{{$enumName}}{{.Name}} = {{.Value}}
+	{{- end}}
+)
+{{- if .NameFunc}}
+
+// {{.IfaceName}}{{.Name}}Name returns the name of a {{.WlIfaceName}}.{{.WlName}} value
+{{- if .BitField}}, or
+// of each flag set in it, joined by "|".  Bits with no name are shown
+// in hex.
+func {{.IfaceName}}{{.Name}}Name(v uint32) string {
+	{{- range .Distinct}}{{if eq .Value "0"}}
+	if v == 0 {
+		return "{{.WlName}}"
+	}
+	{{- end}}{{end}}
+	var names []string
+	for _, e := range [...]struct {
+		v    uint32
+		name string
+	}{
+		{{- range .Distinct}}{{if ne .Value "0"}}
+		{ {{.Value}}, "{{.WlName}}"},
+		{{- end}}{{end}}
+	} {
+		if v&e.v == e.v {
+			names = append(names, e.name)
+			v &^= e.v
+		}
+	}
+	if v != 0 || len(names) == 0 {
+		names = append(names, "0x"+strconv.FormatUint(uint64(v), 16))
+	}
+	return strings.Join(names, "|")
+}
+{{- else}},
+// or its number if it has none.
+func {{.IfaceName}}{{.Name}}Name(v uint32) string {
+	switch v {
+	{{- range .Distinct}}
+	case {{.Value}}:
+		return "{{.WlName}}"
+	{{- end}}
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+{{- end}}
+{{- end}}
+`
+)
+
+// InheritedNames are the core protocol interfaces other protocols may
+// refer to; they are generated into package wl.
+var InheritedNames = []string{
+	"wl_display",
+	"wl_registry",
+	"wl_callback",
+	"wl_compositor",
+	"wl_shm_pool",
+	"wl_shm",
+	"wl_buffer",
+	"wl_data_offer",
+	"wl_data_source",
+	"wl_data_device",
+	"wl_data_device_manager",
+	"wl_shell",
+	"wl_shell_surface",
+	"wl_surface",
+	"wl_seat",
+	"wl_pointer",
+	"wl_keyboard",
+	"wl_touch",
+	"wl_output",
+	"wl_region",
+	"wl_subcompositor",
+	"wl_subsurface",
+}
+
+func reflow(text string) string {
+	ret := ""
+	for _, line := range strings.Split(text, "\n") {
+		ret = ret + "// " + strings.TrimSpace(line) + "\n"
+	}
+	return ret
+}
+
+func (g *Generator) stripUnstable(ifname string) string {
+	return strings.TrimSuffix(ifname, g.trimSuffix)
+}
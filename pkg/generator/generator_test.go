@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// sample reads testdata/sample.xml with the annotations of
+// testdata/sample.yaml, leaving out what exclude names.
+func sample(t *testing.T, exclude ...string) *protocol.Protocol {
+	t.Helper()
+	data, err := ioutil.ReadFile("testdata/sample.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prot, err := protocol.Decode("testdata/sample.xml", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.Exclude(prot, exclude); err != nil {
+		t.Fatal(err)
+	}
+	text, err := ioutil.ReadFile("testdata/sample.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann, err := protocol.ReadAnnotations("testdata/sample.yaml", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.Annotate(prot, ann); err != nil {
+		t.Fatal(err)
+	}
+	return prot
+}
+
+// generate returns the Go code Generate produces for prot with opts.
+func generate(t *testing.T, prot *protocol.Protocol, opts Options) []byte {
+	t.Helper()
+	files, err := Generate(prot, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0].Data
+}
+
+// everything is Options with every option of the generated code on.
+func everything(pkg string) Options {
+	return Options{
+		Package:          pkg,
+		Source:           "testdata/sample.xml",
+		Metrics:          true,
+		Middleware:       true,
+		Metadata:         true,
+		Binders:          true,
+		EnumNames:        true,
+		MessageNames:     true,
+		Wait:             true,
+		Filters:          true,
+		Clone:            true,
+		JSON:             true,
+		GuardDestroyed:   true,
+		Release:          true,
+		TrackObjects:     true,
+		Queue:            4,
+		Descriptor:       true,
+		DispatchTable:    2,
+		StrictDecode:     true,
+		ValidateRequests: true,
+		EmbedXML:         true,
+	}
+}
+
+func TestExcludeKeepsOpcodes(t *testing.T) {
+	prot := sample(t, "sample_manager.create_thing", "sample_thing.excluded")
+	tests := []struct {
+		name string
+		opts Options
+		code string
+		want bool
+	}{
+		{"request", Options{}, "SendRequest(p, 2, parent, wl.Proxy(ret), format)", true},
+		{"excluded request", Options{}, "CreateThing", false},
+		{"event before", Options{}, "case 2:", true},
+		{"excluded event", Options{}, "case 3:", false},
+		{"event after", Options{}, "case 4:", true},
+		{"table before", Options{DispatchTable: 2}, "2: func(p *Thing", true},
+		{"table excluded", Options{DispatchTable: 2}, "3: func(p *Thing", false},
+		{"table after", Options{DispatchTable: 2}, "4: func(p *Thing", true},
+		{"table gap", Options{DispatchTable: 2}, "if f := eventTableThing[event.Opcode]; f != nil {", true},
+	}
+	for _, test := range tests {
+		test.opts.Package = "sample"
+		src := generate(t, prot, test.opts)
+		if got := bytes.Contains(src, []byte(test.code)); got != test.want {
+			t.Errorf("%s: generated code has %q: %v, want %v", test.name, test.code, got, test.want)
+		}
+	}
+}
+
+// trackTest destroys a callback by its done event and then releases
+// it, which must count it out only once.
+const trackTest = `package sample
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dkolbly/wl"
+)
+
+func TestTrackDestructorEvent(t *testing.T) {
+	cb := new(Callback)
+	trackObject("sample_callback", 1) // as NewCallback does
+	done := func() { cb.Dispatch(&wl.Event{Opcode: 0, Data: bytes.NewBuffer(make([]byte, 4))}) }
+	done()
+	cb.Release()
+	done()
+	if live := DebugLiveObjects(); len(live) != 0 {
+		t.Errorf("live objects after done and Release: %v, want none", live)
+	}
+}
+`
+
+func TestTrackDestructorEvent(t *testing.T) {
+	for _, guard := range []bool{false, true} {
+		opts := Options{TrackObjects: true, Release: true, GuardDestroyed: guard}
+		runGenerated(t, sample(t), opts, trackTest, "-run", "TrackDestructorEvent")
+	}
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// Annotations can group the x, y, width and height args of a message
+// into a Rect, and x and y into a Point, in place of the first of them.
+// The types are the package's own, generated when a message uses them.
+
+var geometryFields = []string{"X", "Y", "Width", "Height"}
+
+// groupOf returns the group the annotation a of a message puts the
+// named arg in, and the arg's field in it, as in Rect and Width.
+func groupOf(a *protocol.Annotation, arg string) (group, field string) {
+	if a == nil {
+		return "", ""
+	}
+	for n, name := range a.Rect {
+		if name == arg {
+			return "Rect", geometryFields[n]
+		}
+	}
+	for n, name := range a.Point {
+		if name == arg {
+			return "Point", geometryFields[n]
+		}
+	}
+	return "", ""
+}
+
+// paramOf is the request parameter of a group.
+func paramOf(group string) string {
+	return strings.ToLower(group)
+}
+
+type geometry struct {
+	Point, Rect bool
+}
+
+func geometryOf(prot *protocol.Protocol) geometry {
+	var g geometry
+	use := func(a *protocol.Annotation) {
+		if a != nil {
+			g.Point = g.Point || len(a.Point) > 0
+			g.Rect = g.Rect || len(a.Rect) > 0
+		}
+	}
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			if !req.Excluded {
+				use(req.Annotation)
+			}
+		}
+		for _, ev := range iface.Events {
+			if !ev.Excluded {
+				use(ev.Annotation)
+			}
+		}
+	}
+	return g
+}
+
+// GeometryTypes returns the types generated for the messages of prot
+// that annotations group args of.
+func GeometryTypes(prot *protocol.Protocol) []string {
+	var types []string
+	g := geometryOf(prot)
+	if g.Point {
+		types = append(types, "Point")
+	}
+	if g.Rect {
+		types = append(types, "Rect")
+	}
+	return types
+}
+
+var geometryTemplate = `
+{{- if .Point}}
+
+// A Point is a position given by x and y args of the protocol, in
+// whatever coordinates the message has them in.
+type Point struct {
+	X, Y int32
+}
+{{- end}}
+{{- if .Rect}}
+
+// A Rect is a rectangle given by x, y, width and height args of the
+// protocol, in whatever coordinates the message has them in.
+type Rect struct {
+	X, Y, Width, Height int32
+}
+{{- end}}
+`
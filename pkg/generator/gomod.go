@@ -0,0 +1,29 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GoModFile is the name the go.mod emitter writes to.
+const GoModFile = "go.mod"
+
+// goModFile makes the generated package a module of its own, requiring
+// the wl runtime, so it can be published as it stands.  The core
+// protocol is generated into the runtime itself and so has no require.
+func goModFile(m *Model) ([]File, error) {
+	opts := m.Options
+	if opts.Module == "" {
+		return nil, fmt.Errorf("a %s needs a module path", GoModFile)
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "module %s\n\ngo %s\n", opts.Module, opts.goVersion())
+	if opts.Package != "wl" {
+		if !strings.HasPrefix(opts.RuntimeVersion, "v") {
+			return nil, fmt.Errorf("a %s needs the version of %s to require (e.g., v0.1.0), not %q",
+				GoModFile, runtimeImport, opts.RuntimeVersion)
+		}
+		fmt.Fprintf(&buf, "\nrequire %s %s\n", runtimeImport, opts.RuntimeVersion)
+	}
+	return []File{{GoModFile, []byte(buf.String())}}, nil
+}
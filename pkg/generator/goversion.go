@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// The generated code builds with Go 1.16, for embed, unless
+// Options.GoVersion allows it newer language and library features:
+// from 1.18, any and a generic array conversion; from 1.21, the max
+// builtin; from 1.23, event streams as an iter.Seq rather than a
+// channel.
+
+// defaultGoMinor is the Go 1.x the generated code builds with by
+// default, and the oldest it can be asked to.
+const defaultGoMinor = 16
+
+var goVersionPattern = regexp.MustCompile(`^1\.([0-9]+)(\.[0-9]+)?$`)
+
+// goMinorOf returns the x of the Go 1.x version v, as in 1.21 or
+// 1.21.0, or defaultGoMinor if v is empty.
+func goMinorOf(v string) (int, error) {
+	if v == "" {
+		return defaultGoMinor, nil
+	}
+	m := goVersionPattern.FindStringSubmatch(v)
+	if m == nil {
+		return 0, fmt.Errorf("Go version %q is not like 1.21", v)
+	}
+	minor, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, fmt.Errorf("Go version %q is not like 1.21", v)
+	}
+	if minor < defaultGoMinor {
+		return 0, fmt.Errorf("Go version %s is older than the 1.%d the generated code needs", v, defaultGoMinor)
+	}
+	return minor, nil
+}
+
+// goVersion returns the Go version for the go directive of a go.mod.
+func (o Options) goVersion() string {
+	if o.GoVersion == "" {
+		return fmt.Sprintf("1.%d", defaultGoMinor)
+	}
+	return o.GoVersion
+}
+
+// goAtLeast reports whether the generated code can use what Go 1.minor
+// brought.
+func (g *Generator) goAtLeast(minor int) bool {
+	return g.goMinor >= minor
+}
+
+// anyType is the empty interface, spelt as the Go version allows.
+func (g *Generator) anyType() string {
+	if g.goAtLeast(18) {
+		return "any"
+	}
+	return "interface{}"
+}
+
+// convertTo returns the function converting an array to one of
+// elements of type to, int32 or uint32.
+func (g *Generator) convertTo(to string) string {
+	if g.goAtLeast(18) {
+		return "convertSlice[" + to + "]"
+	}
+	if to == "uint32" {
+		return "toUint32s"
+	}
+	return "toInt32s"
+}
+
+var eventStreamTemplate = `
+// eventStreamSize is how many events an Events stream holds for a
+// reader that falls behind, before it drops them.
+const eventStreamSize = 16
+`
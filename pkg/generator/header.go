@@ -0,0 +1,117 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// HeaderData is what a Header template can refer to.
+type HeaderData struct {
+	Protocol string // protocol name, e.g. xdg_shell
+	Version  int    // highest interface version in the protocol
+	Package  string
+	Source   string
+	Command  string // the command line, from Options
+}
+
+// fileHeader returns the SPDX line and the rendered Header template,
+// if any, for the protocol.  The result is separated from what follows
+// by a blank line so it is never taken for the package comment.
+func (g *Generator) fileHeader(prot *protocol.Protocol) (string, error) {
+	opts := g.opts
+	spdxLine := ""
+	if opts.SPDX != "" {
+		spdxLine = "// SPDX-License-Identifier: " + opts.SPDX + "\n"
+	}
+	if opts.Header == "" {
+		if spdxLine == "" {
+			return "", nil
+		}
+		return spdxLine + "\n", nil
+	}
+	if g.header == nil {
+		tmpl, err := template.New("header").Parse(opts.Header)
+		if err != nil {
+			return "", err
+		}
+		g.header = tmpl
+	}
+
+	data := HeaderData{
+		Protocol: prot.Name,
+		Version:  protocolVersion(prot),
+		Package:  opts.Package,
+		Source:   opts.Source,
+		Command:  opts.Command,
+	}
+
+	var buf bytes.Buffer
+	if err := g.header.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	text := spdxLine + strings.TrimRight(buf.String(), "\n")
+	if text == "" {
+		return "", nil
+	}
+	return text + "\n\n", nil
+}
+
+// protocolVersion stands in for a protocol version, which wayland
+// protocols do not have: the highest version of any of its interfaces.
+func protocolVersion(prot *protocol.Protocol) int {
+	version := 0
+	for _, iface := range prot.Interfaces {
+		if iface.Version > version {
+			version = iface.Version
+		}
+	}
+	return version
+}
+
+// writeProvenance records where the generated code came from.  It
+// does not record when, so that the same inputs and flags always give
+// the same output.  With Reproducible the source path, which differs
+// between machines, is replaced by the protocol name, version and a
+// hash of the source.
+func (g *Generator) writeProvenance(prot *protocol.Protocol) {
+	fmt.Fprintf(&g.out, "// generated by wl-scanner\n// https://github.com/dkolbly/wl-scanner\n")
+	if g.opts.InputHash != "" {
+		fmt.Fprintf(&g.out, "// inputs: sha256 %s\n", g.opts.InputHash)
+	}
+	if g.opts.Reproducible {
+		fmt.Fprintf(&g.out, "// from: %s version %d, sha256 %x\n",
+			prot.Name, protocolVersion(prot), sha256.Sum256(g.opts.SourceData))
+	} else {
+		fmt.Fprintf(&g.out, "// from: %s\n", g.opts.Source)
+	}
+	if g.opts.Stats {
+		fmt.Fprintf(&g.out, "// %s\n", statsOf(prot, g.opts.SourceData))
+	}
+}
+
+// statsOf sums up what is generated from prot, as space separated
+// key=value pairs after "stats:", for tools tracking a binding's
+// growth.  Excluded messages are not counted, and sha256 is that of the
+// source as read.
+func statsOf(prot *protocol.Protocol, source []byte) string {
+	requests, events := 0, 0
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			if !req.Excluded {
+				requests++
+			}
+		}
+		for _, ev := range iface.Events {
+			if !ev.Excluded {
+				events++
+			}
+		}
+	}
+	return fmt.Sprintf("stats: interfaces=%d requests=%d events=%d version=%d sha256=%x",
+		len(prot.Interfaces), requests, events, protocolVersion(prot), sha256.Sum256(source))
+}
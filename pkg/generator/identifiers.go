@@ -0,0 +1,217 @@
+package generator
+
+import (
+	"strconv"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// An Identifier is an exported Go name the generated code declares, at
+// package level or as a method or field of one of its types.
+type Identifier struct {
+	Scope string // the type it is a method or field of; empty at package level
+	Name  string
+	What  string // what it is generated for, as in "event wl_pointer.motion"
+	Line  int    // of what it is generated for, or 0 for an option
+}
+
+// baseProxyMethods are promoted from the runtime's BaseProxy, which
+// every proxy type embeds.
+var baseProxyMethods = []string{"Context", "SetContext", "Id", "SetId"}
+
+// Identifiers returns the exported names Generate declares for prot
+// with opts, options first, then the interfaces in protocol order, so
+// that names two definitions would both declare can be reported before
+// anything is generated rather than as a package that does not
+// compile.  It follows the templates: whatever they declare under some
+// option, it lists under the same option.  Names declared by Imports,
+// Snippet and InterfaceSnippets are the caller's own, and not listed.
+func Identifiers(prot *protocol.Protocol, opts Options) []Identifier {
+	var ids []Identifier
+	add := func(scope, name, what string, line int) {
+		ids = append(ids, Identifier{scope, name, what, line})
+	}
+	option := func(field string, names ...string) {
+		for _, name := range names {
+			add("", name, "the "+field+" option", 0)
+		}
+	}
+	wl := opts.Package == "" || opts.Package == "wl"
+
+	if opts.EmbedXML {
+		option("EmbedXML", "ProtocolXML")
+	}
+	if opts.Metrics {
+		option("Metrics", "RegisterMetrics")
+	}
+	if opts.Middleware {
+		option("Middleware", "DispatchFunc", "SendFunc", "UseDispatch", "UseSend")
+	}
+	if opts.DispatchTable > 0 {
+		option("DispatchTable", "InvalidOpcodeError", "DispatchErrorHandler")
+	} else if opts.StrictDecode {
+		option("StrictDecode", "InvalidOpcodeError", "DispatchErrorHandler")
+	}
+	if opts.StrictDecode {
+		option("StrictDecode", "DecodeError")
+	}
+	if opts.ValidateRequests {
+		option("ValidateRequests", "RequestError")
+	}
+	if opts.GuardDestroyed {
+		option("GuardDestroyed", "ErrProxyDestroyed")
+	}
+	if opts.TrackObjects {
+		option("TrackObjects", "DebugLiveObjects")
+	}
+	for _, name := range GeometryTypes(prot) {
+		add("", name, "annotations", 0)
+	}
+	if opts.Metadata {
+		option("Metadata", "ArgInfo", "MessageInfo", "InterfaceInfo", "Interfaces")
+	}
+	globals := make(map[string]bool)
+	if opts.Binders {
+		for _, global := range Globals(prot) {
+			globals[global] = true
+			name := opts.TypeName(global)
+			what := "interface " + global
+			add("", name+"InterfaceName", what, 0)
+			add("", name+"MaxVersion", what, 0)
+			scope := ""
+			if wl {
+				scope = "Registry"
+			}
+			add(scope, "Bind"+name, what, 0)
+			add(scope, "Bind"+name+"AtLeast", what, 0)
+		}
+	}
+	if opts.Descriptor {
+		option("Descriptor", "ProtocolInfo", "ProtocolInterface", "Protocol")
+	}
+
+	for _, iface := range prot.Interfaces {
+		name := opts.TypeName(iface.Name)
+		what := "interface " + iface.Name
+		add("", name, what, iface.Line)
+		add("", "New"+name, what, iface.Line)
+		if opts.Metadata {
+			add("", name+"Interface", what, iface.Line)
+		}
+
+		add(name, "BaseProxy", "the wl runtime", 0)
+		for _, m := range baseProxyMethods {
+			add(name, m, "BaseProxy", 0)
+		}
+		if globals[iface.Name] {
+			add(name, "Version", "the Binders option", 0)
+		}
+		if opts.MessageNames {
+			add(name, "RequestName", "the MessageNames option", 0)
+			add(name, "EventName", "the MessageNames option", 0)
+		}
+		if opts.Release && iface.Name != "wl_display" && !hasDestructor(iface) {
+			add(name, "Release", "the Release option", 0)
+		}
+
+		for _, req := range iface.Requests {
+			if !req.Excluded {
+				add(name, opts.MessageName(req.Name, req.Annotation), "request "+iface.Name+"."+req.Name, req.Line)
+			}
+		}
+
+		events := false
+		for _, ev := range iface.Events {
+			if ev.Excluded {
+				continue
+			}
+			events = true
+			what := "event " + iface.Name + "." + ev.Name
+			evName := opts.MessageName(ev.Name, ev.Annotation)
+			eName := name + evName
+			add("", eName+"Event", what, ev.Line)
+			add("", eName+"Handler", what, ev.Line)
+			add(eName+"Handler", "Handle"+eName, what, ev.Line)
+			add(name, "Add"+evName+"Handler", what, ev.Line)
+			add(name, "Remove"+evName+"Handler", what, ev.Line)
+			if opts.Filters {
+				add(name, "Add"+evName+"HandlerFiltered", what, ev.Line)
+			}
+			if opts.Wait {
+				add(name, "Wait"+evName, what, ev.Line)
+				add(name, evName+"Events", what, ev.Line)
+			}
+
+			grouped := make(map[string]bool)
+			for _, arg := range ev.Args {
+				field := opts.GoName(arg.Name)
+				if arg.Annotation != nil && arg.Annotation.GoName != "" {
+					field = arg.Annotation.GoName
+				}
+				if group, _ := groupOf(ev.Annotation, arg.Name); group != "" {
+					if grouped[group] {
+						continue
+					}
+					grouped[group] = true
+					field = group
+				}
+				add(eName+"Event", field, "arg "+iface.Name+"."+ev.Name+"."+arg.Name, arg.Line)
+			}
+			if opts.Clone {
+				add(eName+"Event", "Clone", "the Clone option", 0)
+			}
+			if opts.JSON {
+				add(eName+"Event", "MarshalJSON", "the JSON option", 0)
+				add(eName+"Event", "UnmarshalJSON", "the JSON option", 0)
+			}
+		}
+		if events {
+			add(name, "Dispatch", "event dispatch", iface.Line)
+			if opts.Queue > 0 {
+				add(name, "Poll", "the Queue option", 0)
+				add(name, "Flush", "the Queue option", 0)
+			}
+		}
+
+		for _, enum := range iface.Enums {
+			what := "enum " + iface.Name + "." + enum.Name
+			prefix := name + opts.GoName(enum.Name)
+			if opts.EnumNames && hasValues(enum) {
+				add("", prefix+"Name", what, enum.Line)
+			}
+			if a := enum.Annotation; a != nil && a.FourCC && hasFourCC(enum) {
+				for _, f := range FourCCFuncs {
+					add("", prefix+f, what, enum.Line)
+				}
+			}
+			for _, entry := range enum.Entries {
+				add("", prefix+opts.GoName(entry.Name), "enum entry "+iface.Name+"."+enum.Name+"."+entry.Name, entry.Line)
+			}
+		}
+	}
+	return ids
+}
+
+// hasValues reports whether any entry of enum has a value the
+// generated code can use as a number.
+func hasValues(enum protocol.Enum) bool {
+	for _, entry := range enum.Entries {
+		if _, err := strconv.ParseUint(entry.Value, 0, 32); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFourCC reports whether any entry of enum is a fourcc code, or one
+// of the formats wl_shm numbers apart from its code, without which no
+// fourcc functions are generated.
+func hasFourCC(enum protocol.Enum) bool {
+	for _, entry := range enum.Entries {
+		v, err := strconv.ParseUint(entry.Value, 0, 32)
+		if err == nil && (isFourCC(v) || renumbered[entry.Name] != "") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fixedTypes are declared the same way whatever the protocol, so
+// Identifiers lists them but not their fields and methods.
+var fixedTypes = map[string]bool{
+	"DecodeError": true, "InvalidOpcodeError": true, "RequestError": true,
+	"ArgInfo": true, "MessageInfo": true, "InterfaceInfo": true,
+	"ProtocolInfo": true, "ProtocolInterface": true,
+	"Point": true, "Rect": true,
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		opts    Options
+	}{
+		{"plain", nil, Options{Package: "sample"}},
+		{"everything", nil, everything("sample")},
+		{"excluded", []string{"sample_thing.excluded", "sample_manager.get_child"}, everything("sample")},
+		{"wl", nil, Options{Package: "wl", Binders: true, StrictDecode: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prot := sample(t, test.exclude...)
+			declared := declaredIn(t, generate(t, prot, test.opts))
+			listed := make(map[string]bool)
+			for _, id := range Identifiers(prot, test.opts) {
+				key := id.Scope + "." + id.Name
+				listed[key] = true
+				if !declared[key] && id.What != "BaseProxy" {
+					t.Errorf("%s is listed for %s but not declared", key, id.What)
+				}
+			}
+			var missing []string
+			for key := range declared {
+				if !listed[key] {
+					missing = append(missing, key)
+				}
+			}
+			sort.Strings(missing)
+			for _, key := range missing {
+				t.Errorf("%s is declared but not listed", key)
+			}
+		})
+	}
+}
+
+// declaredIn returns the exported names the Go source declares, as
+// Scope.Name: at package level with an empty scope, and as the
+// methods, fields and interface methods of its types.
+func declaredIn(t *testing.T, src []byte) map[string]bool {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "sample.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared := make(map[string]bool)
+	add := func(scope, name string) {
+		if ast.IsExported(name) && (scope == "" || ast.IsExported(scope) && !fixedTypes[scope]) {
+			declared[scope+"."+name] = true
+		}
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			scope := ""
+			if decl.Recv != nil {
+				scope = strings.TrimPrefix(exprString(decl.Recv.List[0].Type), "*")
+			}
+			add(scope, decl.Name.Name)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						add("", name.Name)
+					}
+				case *ast.TypeSpec:
+					add("", spec.Name.Name)
+					switch typ := spec.Type.(type) {
+					case *ast.StructType:
+						for _, field := range typ.Fields.List {
+							if field.Names == nil {
+								embedded := exprString(field.Type)
+								add(spec.Name.Name, embedded[strings.LastIndexByte(embedded, '.')+1:])
+							}
+							for _, name := range field.Names {
+								add(spec.Name.Name, name.Name)
+							}
+						}
+					case *ast.InterfaceType:
+						for _, method := range typ.Methods.List {
+							for _, name := range method.Names {
+								add(spec.Name.Name, name.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return declared
+}
+
+// exprString spells a type as it is written, for the receivers and
+// embedded fields declaredIn names.
+func exprString(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.StarExpr:
+		return "*" + exprString(x.X)
+	case *ast.SelectorExpr:
+		return exprString(x.X) + "." + x.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// JSON marshalling gives event types MarshalJSON and UnmarshalJSON
+// methods writing them as an object keyed by the protocol's arg names,
+// for logging them structurally or forwarding them to debugging tools:
+// values of enums are written as the names of their entries, fds and
+// fixed-point numbers as numbers, and proxies as their object ids.
+// Unmarshalling cannot turn ids back into proxies without the
+// connection, so it leaves those fields alone.
+
+type (
+	jsonEvent struct {
+		Type   string // of the event struct
+		Fields []jsonField
+	}
+
+	jsonField struct {
+		Name, Type, Key string // of the field of the JSON struct
+		Marshal         string // setting it from the event, ev
+		Unmarshal       string // setting the event from it, if it can
+	}
+
+	jsonEnumTable struct {
+		Var, WlName string
+		BitField    bool
+		Entries     []GoEntry // distinct
+	}
+)
+
+// jsonEnumVar is the variable holding the entries of the enum of iface
+// named name, for writing its values in JSON.
+func (g *Generator) jsonEnumVar(name string) string {
+	i := strings.LastIndex(name, ".")
+	return "json" + g.names[g.stripUnstable(name[:i])] + g.camelCase(name[i+1:])
+}
+
+// jsonField returns how arg of an event of iface, goarg in Go, is
+// written in JSON.
+func (g *Generator) jsonField(iface string, arg protocol.Arg, goarg GoArg) jsonField {
+	f := jsonField{Name: camelCase(arg.Name, ""), Type: goarg.Type, Key: arg.Name}
+	value := "ev." + goarg.Name
+	enum := arg.Enum
+	if !strings.Contains(enum, ".") {
+		enum = iface + "." + enum
+	}
+	_, local := g.enums[enum]
+	switch {
+	case arg.Type == "object" || arg.Type == "new_id":
+		f.Type = "*" + g.wlPrefix + "ProxyId"
+		f.Marshal = fmt.Sprintf("if %s != nil {\nid := %s.Id()\nv.%s = &id\n}", value, value, f.Name)
+		return f
+	case arg.Enum != "" && local && arg.Type == "array":
+		elem := strings.TrimPrefix(goarg.Type, "[]")
+		table := g.jsonEnumVar(enum)
+		f.Type = "[]json.RawMessage"
+		f.Marshal = fmt.Sprintf("for _, x := range %s {\nv.%s = append(v.%s, %s.marshal(uint32(x)))\n}",
+			value, f.Name, f.Name, table)
+		f.Unmarshal = fmt.Sprintf("%s = nil\nfor _, x := range v.%s {\n%s = append(%s, %s(%s.unmarshal(x, &err)))\n}",
+			value, f.Name, value, value, elem, table)
+		return f
+	case arg.Enum != "" && local && (arg.Type == "int" || arg.Type == "uint"):
+		table := g.jsonEnumVar(enum)
+		f.Type = "json.RawMessage"
+		f.Marshal = fmt.Sprintf("v.%s = %s.marshal(uint32(%s))", f.Name, table, value)
+		f.Unmarshal = fmt.Sprintf("%s = %s(%s.unmarshal(v.%s, &err))", value, goarg.Type, table, f.Name)
+		return f
+	}
+	f.Marshal = fmt.Sprintf("v.%s = %s", f.Name, value)
+	f.Unmarshal = fmt.Sprintf("%s = v.%s", value, f.Name)
+	return f
+}
+
+// jsonEnums returns the tables of the enums of prot the events of its
+// generated interfaces have values of, by variable name.
+func (g *Generator) jsonEnums(prot *protocol.Protocol) []jsonEnumTable {
+	used := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		for _, ev := range iface.Events {
+			if ev.Excluded {
+				continue
+			}
+			for _, arg := range ev.Args {
+				name := arg.Enum
+				if name != "" && !strings.Contains(name, ".") {
+					name = iface.Name + "." + name
+				}
+				if _, ok := g.enums[name]; ok {
+					used[name] = true
+				}
+			}
+		}
+	}
+
+	var tables []jsonEnumTable
+	for name := range used {
+		enum := g.enums[name]
+		t := jsonEnumTable{Var: g.jsonEnumVar(name), WlName: name, BitField: enum.BitField}
+		seen := make(map[uint64]bool)
+		for _, entry := range enum.Entries {
+			v, err := strconv.ParseUint(entry.Value, 0, 32)
+			if err != nil || seen[v] {
+				continue
+			}
+			seen[v] = true
+			t.Entries = append(t.Entries, GoEntry{WlName: entry.Name, Value: strconv.FormatUint(v, 10)})
+		}
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(a, b int) bool { return tables[a].Var < tables[b].Var })
+	return tables
+}
+
+var jsonTemplate = `
+// jsonEnum is an enum whose values are written in JSON by the names of
+// their entries.
+type jsonEnum struct {
+	name     string // as in wl_shm.format
+	bitfield bool
+	entries  []jsonEntry
+}
+
+type jsonEntry struct {
+	v    uint32
+	name string
+}
+
+// marshal returns v as the name of its entry or, for a bitfield, the
+// names of the flags set in it joined by "|", or as a number if it
+// has none.
+func (e jsonEnum) marshal(v uint32) json.RawMessage {
+	var names []string
+	rest := v
+	for _, entry := range e.entries {
+		switch {
+		case entry.v == v:
+			names, rest = []string{entry.name}, 0
+		case e.bitfield && entry.v != 0 && rest&entry.v == entry.v:
+			names = append(names, entry.name)
+			rest &^= entry.v
+		default:
+			continue
+		}
+		if rest == 0 {
+			break
+		}
+	}
+	if rest != 0 || len(names) == 0 {
+		return json.RawMessage(strconv.FormatUint(uint64(v), 10))
+	}
+	data, _ := json.Marshal(strings.Join(names, "|"))
+	return data
+}
+
+// unmarshal returns the value data, written by marshal, stands for,
+// or sets *err, if it is not already set, and returns 0.
+func (e jsonEnum) unmarshal(data json.RawMessage, err *error) uint32 {
+	var v uint32
+	if len(data) == 0 || json.Unmarshal(data, &v) == nil {
+		return v
+	}
+	var s string
+	if jsonErr := json.Unmarshal(data, &s); jsonErr != nil {
+		if *err == nil {
+			*err = fmt.Errorf("%s: %v", e.name, jsonErr)
+		}
+		return 0
+	}
+	names := []string{s}
+	if e.bitfield {
+		names = strings.Split(s, "|")
+	}
+names:
+	for _, name := range names {
+		for _, entry := range e.entries {
+			if entry.name == name {
+				v |= entry.v
+				continue names
+			}
+		}
+		if *err == nil {
+			*err = fmt.Errorf("%q is not an entry of %s", name, e.name)
+		}
+		return 0
+	}
+	return v
+}
+{{- range .}}
+
+var {{.Var}} = jsonEnum{"{{.WlName}}", {{.BitField}}, []jsonEntry{
+	{{- range .Entries}}
+	{ {{.Value}}, "{{.WlName}}"},
+	{{- end}}
+}}
+{{- end}}
+`
+
+var eventJSONTemplate = `
+// MarshalJSON writes ev as an object keyed by the names of its args,
+// with proxies as their object ids.
+func (ev {{.Type}}) MarshalJSON() ([]byte, error) {
+	var v struct {
+		{{- range .Fields}}
+		{{.Name}} {{.Type}} ` + "`" + `json:"{{.Key}}"` + "`" + `
+		{{- end}}
+	}
+	{{- range .Fields}}
+	{{.Marshal}}
+	{{- end}}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON reads what MarshalJSON writes into ev, leaving its
+// proxies alone.
+func (ev *{{.Type}}) UnmarshalJSON(data []byte) error {
+	var v struct {
+		{{- range .Fields}}
+		{{.Name}} {{.Type}} ` + "`" + `json:"{{.Key}}"` + "`" + `
+		{{- end}}
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var err error
+	{{- range .Fields}}
+	{{- with .Unmarshal}}
+	{{.}}
+	{{- end}}
+	{{- end}}
+	return err
+}
+`
@@ -0,0 +1,26 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// licenseFile carries the protocol's <copyright> text along with the
+// generated package, since the generated code is derived from the
+// protocol and so falls under its license.
+func licenseFile(m *Model) ([]File, error) {
+	prot := m.Protocol
+	if prot.Copyright == "" {
+		return nil, nil
+	}
+	text := fmt.Sprintf("The code in this directory was generated from the %s protocol,\nwhich carries the following notice:\n\n%s\n",
+		prot.Name, protocol.Text(prot.Copyright))
+	return []File{{m.Options.License, []byte(text)}}, nil
+}
+
+// writeCopyrightHeader puts the protocol's <copyright> text at the top
+// of the generated file.
+func (g *Generator) writeCopyrightHeader(prot *protocol.Protocol) {
+	fmt.Fprintf(&g.out, "%s\n\n", goComment("", prot.Copyright))
+}
@@ -0,0 +1,105 @@
+package generator
+
+import "encoding/json"
+
+// ManifestFile is the name of the File Generate returns for Manifest.
+const ManifestFile = "manifest.json"
+
+// The manifest maps every wayland name in a protocol to the Go symbols
+// generated for it, for IDE plugins and migration scripts.
+type (
+	Manifest struct {
+		Protocol   string              `json:"protocol"`
+		Package    string              `json:"package"`
+		Interfaces []InterfaceManifest `json:"interfaces"`
+	}
+
+	InterfaceManifest struct {
+		Wayland     string            `json:"wayland"`
+		Type        string            `json:"type"`
+		Constructor string            `json:"constructor"`
+		Requests    []RequestManifest `json:"requests,omitempty"`
+		Events      []EventManifest   `json:"events,omitempty"`
+		Enums       []EnumManifest    `json:"enums,omitempty"`
+	}
+
+	RequestManifest struct {
+		Wayland string `json:"wayland"`
+		Opcode  int    `json:"opcode"`
+		Method  string `json:"method"`
+	}
+
+	EventManifest struct {
+		Wayland       string `json:"wayland"`
+		Opcode        int    `json:"opcode"`
+		Event         string `json:"event"`
+		Handler       string `json:"handler"`
+		HandlerMethod string `json:"handler_method"`
+		Add           string `json:"add"`
+		Remove        string `json:"remove"`
+	}
+
+	EnumManifest struct {
+		Wayland string          `json:"wayland"`
+		Entries []EntryManifest `json:"entries"`
+	}
+
+	EntryManifest struct {
+		Wayland  string `json:"wayland"`
+		Value    string `json:"value"`
+		Constant string `json:"constant"`
+	}
+)
+
+func newManifest(model *Model) *Manifest {
+	m := &Manifest{
+		Protocol: model.Protocol.Name,
+		Package:  model.Options.Package,
+	}
+	for _, i := range model.Interfaces {
+		im := InterfaceManifest{
+			Wayland:     i.WlInterface.Name,
+			Type:        i.Name,
+			Constructor: "New" + i.Name,
+		}
+		for _, req := range i.Requests {
+			im.Requests = append(im.Requests, RequestManifest{
+				Wayland: req.WlName,
+				Opcode:  req.Order,
+				Method:  req.Name,
+			})
+		}
+		for _, ev := range i.Events {
+			im.Events = append(im.Events, EventManifest{
+				Wayland:       ev.WlName,
+				Opcode:        ev.Opcode,
+				Event:         ev.EName + "Event",
+				Handler:       ev.EName + "Handler",
+				HandlerMethod: "Handle" + ev.EName,
+				Add:           "Add" + ev.Name + "Handler",
+				Remove:        "Remove" + ev.Name + "Handler",
+			})
+		}
+		for _, enum := range i.Enums {
+			em := EnumManifest{Wayland: enum.WlName}
+			for _, entry := range enum.Entries {
+				em.Entries = append(em.Entries, EntryManifest{
+					Wayland:  entry.WlName,
+					Value:    entry.Value,
+					Constant: enum.IfaceName + enum.Name + entry.Name,
+				})
+			}
+			im.Enums = append(im.Enums, em)
+		}
+		m.Interfaces = append(m.Interfaces, im)
+	}
+	return m
+}
+
+func manifestFile(m *Model) ([]File, error) {
+	data, err := json.MarshalIndent(newManifest(m), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{ManifestFile, append(data, '\n')}}, nil
+}
@@ -0,0 +1,128 @@
+package generator
+
+import "github.com/dkolbly/wl-scanner/pkg/protocol"
+
+// Introspection metadata is the Go counterpart of the wl_interface and
+// wl_message tables libwayland's scanner generates: enough to describe
+// every message on the wire without going back to the XML.
+
+type (
+	metaInterface struct {
+		Var      string
+		Name     string
+		Version  int
+		Requests []metaMessage
+		Events   []metaMessage
+	}
+
+	metaMessage struct {
+		Name       string
+		Since      int
+		Signature  string
+		Destructor bool
+		Args       []protocol.Arg
+	}
+)
+
+func metadataOf(ifaces []GoInterface) []metaInterface {
+	var meta []metaInterface
+	for _, i := range ifaces {
+		wi := i.WlInterface
+		mi := metaInterface{
+			Var:     i.Name + "Interface",
+			Name:    wi.Name,
+			Version: wi.Version,
+		}
+		for _, req := range wi.Requests {
+			mi.Requests = append(mi.Requests, metaMessageOf(req.Name, req.Since, req.Args, req.Type == "destructor"))
+		}
+		for _, ev := range wi.Events {
+			mi.Events = append(mi.Events, metaMessageOf(ev.Name, ev.Since, ev.Args, ev.Type == "destructor"))
+		}
+		meta = append(meta, mi)
+	}
+	return meta
+}
+
+func metaMessageOf(name string, since int, args []protocol.Arg, destructor bool) metaMessage {
+	if since == 0 {
+		since = 1
+	}
+	return metaMessage{
+		Name:       name,
+		Since:      since,
+		Signature:  protocol.Signature(since, args),
+		Destructor: destructor,
+		Args:       args,
+	}
+}
+
+var metadataTemplate = `
+// ArgInfo describes one argument of a protocol message.
+type ArgInfo struct {
+	Name      string
+	Type      string // int, uint, fixed, string, object, new_id, array or fd
+	Interface string // for object and new_id arguments, if known
+	Enum      string
+	AllowNull bool
+}
+
+// MessageInfo describes a request or event.  Signature is in the
+// format libwayland uses for wl_message.
+type MessageInfo struct {
+	Name       string
+	Since      int
+	Signature  string
+	Destructor bool
+	Args       []ArgInfo
+}
+
+// InterfaceInfo describes an interface.  Requests and Events are
+// indexed by opcode.
+type InterfaceInfo struct {
+	Name     string
+	Version  int
+	Requests []MessageInfo
+	Events   []MessageInfo
+}
+
+// Interfaces lists the metadata of every interface in this package.
+var Interfaces = []*InterfaceInfo{
+{{- range .}}
+	{{.Var}},
+{{- end}}
+}
+{{range .}}
+// {{.Var}} describes the {{.Name}} interface.
+var {{.Var}} = &InterfaceInfo{
+	Name:    {{printf "%q" .Name}},
+	Version: {{.Version}},
+{{- if .Requests}}
+	Requests: []MessageInfo{
+	{{- range .Requests}}
+		{{template "message" .}}
+	{{- end}}
+	},
+{{- end}}
+{{- if .Events}}
+	Events: []MessageInfo{
+	{{- range .Events}}
+		{{template "message" .}}
+	{{- end}}
+	},
+{{- end}}
+}
+{{end}}
+{{- define "message" -}}
+{Name: {{printf "%q" .Name}}, Since: {{.Since}}, Signature: {{printf "%q" .Signature}},
+{{- if .Destructor}} Destructor: true,{{end}}
+{{- if .Args}} Args: []ArgInfo{
+		{{- range .Args}}
+			{Name: {{printf "%q" .Name}}, Type: {{printf "%q" .Type}}
+			{{- if .Interface}}, Interface: {{printf "%q" .Interface}}{{end}}
+			{{- if .Enum}}, Enum: {{printf "%q" .Enum}}{{end}}
+			{{- if .AllowNull}}, AllowNull: true{{end}}},
+		{{- end}}
+		}{{end}}},
+{{- end}}
+`
@@ -0,0 +1,21 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetadataDestructors(t *testing.T) {
+	src := string(generate(t, sample(t), Options{Package: "sample", Metadata: true}))
+	for _, want := range []string{
+		`{Name: "destroy", Since: 1, Signature: "", Destructor: true}`,
+		`{Name: "done", Since: 1, Signature: "u", Destructor: true, Args:`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated metadata has no %s", want)
+		}
+	}
+	if strings.Count(src, "Destructor: true") != 2 {
+		t.Errorf("generated metadata has %d destructors, want 2", strings.Count(src, "Destructor: true"))
+	}
+}
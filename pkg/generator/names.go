@@ -0,0 +1,92 @@
+package generator
+
+import "github.com/dkolbly/wl-scanner/pkg/protocol"
+
+// A Symbol is where the Go type for a wayland interface lives.
+type Symbol struct {
+	Package string // Go package name
+	Import  string // import path of the package
+	Type    string
+}
+
+// A NameTable maps wayland interfaces to their Go types across every
+// package generated in one run, so that object arguments referring to
+// another protocol's interfaces resolve to that package's types.
+type NameTable struct {
+	symbols map[string]Symbol
+}
+
+func NewNameTable() *NameTable {
+	return &NameTable{symbols: make(map[string]Symbol)}
+}
+
+// Add records the interfaces of prot as generated with opts into the
+// package at importPath.
+func (t *NameTable) Add(prot *protocol.Protocol, opts Options, importPath string) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "wl"
+	}
+	for _, iface := range prot.Interfaces {
+		t.symbols[iface.Name] = Symbol{
+			Package: pkg,
+			Import:  importPath,
+			Type:    opts.TypeName(iface.Name),
+		}
+	}
+}
+
+// Lookup returns the symbol for the named interface.
+func (t *NameTable) Lookup(wlName string) (Symbol, bool) {
+	sym, ok := t.symbols[wlName]
+	return sym, ok
+}
+
+// importsFor registers the Go types of the interfaces prot refers to
+// but does not define, and returns the import paths their packages
+// need beyond the wl runtime.
+func (g *Generator) importsFor(prot *protocol.Protocol) []string {
+	if g.opts.Names == nil {
+		return nil
+	}
+	own := make(map[string]bool)
+	for _, iface := range prot.Interfaces {
+		own[iface.Name] = true
+	}
+
+	var imports []string
+	seen := make(map[string]bool)
+	refer := func(args []protocol.Arg) {
+		for _, arg := range args {
+			if arg.Interface == "" || own[arg.Interface] {
+				continue
+			}
+			sym, ok := g.opts.Names.Lookup(arg.Interface)
+			if !ok {
+				continue
+			}
+			if sym.Package == g.opts.Package {
+				g.names[arg.Interface] = sym.Type
+				continue
+			}
+			g.names[arg.Interface] = sym.Package + "." + sym.Type
+			if sym.Import != "" && sym.Import != runtimeImport && !seen[sym.Import] {
+				seen[sym.Import] = true
+				imports = append(imports, sym.Import)
+			}
+		}
+	}
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			if !req.Excluded {
+				refer(req.Args)
+			}
+		}
+		for _, ev := range iface.Events {
+			if !ev.Excluded {
+				refer(ev.Args)
+			}
+		}
+	}
+	return imports
+}
@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// runGenerated generates prot with opts into package sample of a
+// scratch GOPATH, next to test, the source of a sample_test.go, and
+// runs go test on it with args, returning what it printed.  It needs
+// go and the wl runtime, and is skipped without them or in -short
+// mode.
+func runGenerated(t *testing.T, prot *protocol.Protocol, opts Options, test string, args ...string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+	gopath, err := exec.Command("go", "env", "GOPATH").Output()
+	if err != nil {
+		t.Skipf("no go: %s", err)
+	}
+	env := append(os.Environ(), "GO111MODULE=off")
+	list := exec.Command("go", "list", runtimeImport)
+	list.Env = env
+	if err := list.Run(); err != nil {
+		t.Skipf("no wl runtime: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "wl-scanner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pkg := filepath.Join(dir, "src", "sample")
+	if err := os.MkdirAll(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts.Package = "sample"
+	files, err := Generate(prot, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files[:1:1], File{"sample_test.go", []byte(test)})
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(pkg, f.Name), f.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("go", append([]string{"test"}, args...)...)
+	cmd.Dir = pkg
+	cmd.Env = append(env, "GOPATH="+dir+string(filepath.ListSeparator)+strings.TrimSpace(string(gopath)))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test: %s\n%s", err, out)
+	}
+	return string(out)
+}
@@ -0,0 +1,177 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// Strict decoding checks each event against the protocol before it is
+// delivered, so handlers are never given a null object the protocol
+// does not allow, a proxy of the wrong type, or a value its enum does
+// not have.  Events failing the checks are reported to
+// DispatchErrorHandler as a DecodeError, and dropped.
+
+// enumsOf indexes the enums of prot by their qualified name, as args
+// refer to enums of other interfaces.
+func enumsOf(prot *protocol.Protocol) map[string]protocol.Enum {
+	enums := make(map[string]protocol.Enum)
+	for _, iface := range prot.Interfaces {
+		for _, enum := range iface.Enums {
+			enums[iface.Name+"."+enum.Name] = enum
+		}
+	}
+	return enums
+}
+
+// hasLengths reports whether any event of prot has a string or array,
+// whose length strict decoding checks.
+func hasLengths(prot *protocol.Protocol) bool {
+	for _, iface := range prot.Interfaces {
+		for _, ev := range iface.Events {
+			for _, arg := range ev.Args {
+				if !ev.Excluded && (arg.Type == "string" || arg.Type == "array") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// strictDecode returns the code decoding and checking arg of the event
+// ev of iface, or "" if there is nothing to check.  Strings and arrays
+// are checked to fit in what is left of the event before they are
+// decoded.
+func (g *Generator) strictDecode(iface, ev string, arg protocol.Arg, goarg GoArg) string {
+	report := func(problem string) string {
+		return fmt.Sprintf("decodeError(p, %q, %q, %q, %s)\nreturn\n", iface, ev, arg.Name, problem)
+	}
+	code := g.strictCheck(iface, arg, goarg, report)
+	if arg.Type != "string" && arg.Type != "array" {
+		return code
+	}
+	if code == "" {
+		code = fmt.Sprintf("ev.%s = %s", goarg.Name, goarg.Decoded())
+	}
+	return fmt.Sprintf("if problem := checkLength(event); problem != \"\" {\n%s}\n%s", report("problem"), code)
+}
+
+// strictCheck returns the code decoding and checking the values arg
+// can have, or "" if there is nothing to check.
+func (g *Generator) strictCheck(iface string, arg protocol.Arg, goarg GoArg, report func(problem string) string) string {
+	field := "ev." + goarg.Name
+
+	var b strings.Builder
+	switch {
+	case arg.Type == "object" && arg.Interface != "":
+		fmt.Fprintf(&b, "switch obj := event.Proxy(p.Context()).(type) {\n")
+		fmt.Fprintf(&b, "case %s:\n%s = obj\n", goarg.Type, field)
+		if arg.AllowNull {
+			fmt.Fprintf(&b, "case nil:\n") // left nil
+		} else {
+			fmt.Fprintf(&b, "case nil:\n%s", report(`"is null"`))
+		}
+		fmt.Fprintf(&b, "default:\n%s}", report(fmt.Sprintf(`fmt.Sprintf("is a %%T, not a %s", obj)`, arg.Interface)))
+	case arg.Type == "object":
+		if arg.AllowNull {
+			return ""
+		}
+		fmt.Fprintf(&b, "%s = %s\n", field, goarg.Decoded())
+		fmt.Fprintf(&b, "if %s == nil {\n%s}", field, report(`"is null"`))
+	case arg.Enum != "" && goarg.BufMethod != "":
+		check := g.enumCheck(iface, arg, report)
+		if check == nil {
+			return ""
+		}
+		fmt.Fprintf(&b, "%s = %s\n", field, goarg.Decoded())
+		if arg.Type == "array" {
+			fmt.Fprintf(&b, "for _, v := range %s {\n%s\n}", field, check("v"))
+		} else {
+			b.WriteString(check(field))
+		}
+	default:
+		return ""
+	}
+	return b.String()
+}
+
+// enumCheck returns a function giving the code that checks a value is
+// of the enum of arg, calling report if not, or nil if the enum cannot
+// be checked: it is from another protocol, or not generated.
+func (g *Generator) enumCheck(iface string, arg protocol.Arg, report func(problem string) string) func(value string) string {
+	name := arg.Enum
+	if !strings.Contains(name, ".") {
+		name = iface + "." + name
+	}
+	enum, ok := g.enums[name]
+	if !ok {
+		return nil
+	}
+	var values []string
+	var mask uint64
+	seen := make(map[uint64]bool)
+	for _, entry := range enum.Entries {
+		v, err := strconv.ParseUint(entry.Value, 0, 32)
+		if err != nil {
+			return nil
+		}
+		mask |= v
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, strconv.FormatUint(v, 10))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return func(value string) string {
+		if enum.BitField {
+			return fmt.Sprintf("if uint32(%s)&^%#x != 0 {\n%s}", value, mask,
+				report(fmt.Sprintf(`fmt.Sprintf("%%#x has bits not in %s", %s)`, name, value)))
+		}
+		return fmt.Sprintf("switch uint32(%s) {\ncase %s:\ndefault:\n%s}", value, strings.Join(values, ", "),
+			report(fmt.Sprintf(`fmt.Sprintf("%%d is not a %s", %s)`, name, value)))
+	}
+}
+
+var strictDecodeTemplate = `
+// DecodeError is an event that breaks the protocol, and so is not
+// delivered.
+type DecodeError struct {
+	Interface string
+	Event     string
+	Arg       string
+	Problem   string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s.%s: %s %s", e.Interface, e.Event, e.Arg, e.Problem)
+}
+
+// decodeError reports an event that cannot be delivered.
+func decodeError(p {{.}}Proxy, iface, event, arg, problem string) {
+	if DispatchErrorHandler != nil {
+		DispatchErrorHandler(p, &DecodeError{iface, event, arg, problem})
+	}
+}
+`
+
+var lengthCheckTemplate = `
+// checkLength checks that the string or array next in event fits in
+// what is left of it, so decoding it can neither read past the event
+// nor allocate for a length the compositor made up.
+func checkLength(event *{{.}}Event) string {
+	left := event.Data.Bytes()
+	if len(left) < 4 {
+		return "is cut short"
+	}
+	n := (&{{.}}Event{Data: bytes.NewBuffer(left[:4:4])}).Uint32()
+	if size := (uint64(n) + 3) &^ 3; size > uint64(len(left)-4) {
+		return fmt.Sprintf("has length %d, which does not fit in the %d bytes left", n, len(left)-4)
+	}
+	return ""
+}
+`
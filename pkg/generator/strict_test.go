@@ -0,0 +1,82 @@
+package generator
+
+import "testing"
+
+// strictTest dispatches events to proxies generated with StrictDecode,
+// checking each is either delivered or reported as a DecodeError.
+const strictTest = `package sample
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/dkolbly/wl"
+)
+
+type handled []string
+
+func (h *handled) HandleManagerFormat(ev ManagerFormatEvent) {
+	*h = append(*h, fmt.Sprintf("format %#x", ev.Format))
+}
+
+func (h *handled) HandleThingState(ev ThingStateEvent) {
+	*h = append(*h, fmt.Sprintf("state %d %q %v %v", ev.State, ev.Name, ev.Keys, ev.Scale))
+}
+
+func (h *handled) HandleThingNeighbour(ev ThingNeighbourEvent) {
+	*h = append(*h, fmt.Sprintf("neighbour %v %d", ev.Other, ev.Distance))
+}
+
+func (h *handled) HandleThingParent(ev ThingParentEvent) {
+	*h = append(*h, fmt.Sprintf("parent %v", ev.Parent))
+}
+
+func TestStrictDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		manager bool // sent to a Manager rather than a Thing
+		opcode  uint32
+		data    []uint32
+		want    string
+	}{
+		{"entry", true, 0, []uint32{0x36314752}, "format 0x36314752"},
+		{"not an entry", true, 0, []uint32{2}, "sample_manager.format: format 2 is not a sample_manager.format"},
+		{"bits", false, 1, []uint32{3, 3, 'a' | 'b'<<8, 4, 7, 256}, "state 3 \"ab\" [7] 1"},
+		{"other bits", false, 1, []uint32{8, 0, 0, 256}, "sample_thing.state: state 0x8 has bits not in sample_thing.state"},
+		{"null string", false, 1, []uint32{1, 0, 0, 256}, "state 1 \"\" [] 1"},
+		{"long string", false, 1, []uint32{1, 100, 0, 0}, "sample_thing.state: label has length 100, which does not fit in the 8 bytes left"},
+		{"long array", false, 1, []uint32{1, 0, 1 << 31, 0}, "sample_thing.state: keys has length 2147483648, which does not fit in the 4 bytes left"},
+		{"no length", false, 1, []uint32{1}, "sample_thing.state: label is cut short"},
+		{"null allowed", false, 2, []uint32{0, 7}, "neighbour <nil> 7"},
+		{"null", false, 5, []uint32{0}, "sample_thing.parent: parent is null"},
+	}
+	for _, test := range tests {
+		var got handled
+		DispatchErrorHandler = func(p wl.Proxy, err error) { got = append(got, err.Error()) }
+		var p interface{ Dispatch(*wl.Event) }
+		if test.manager {
+			m := new(Manager)
+			m.AddFormatHandler(&got)
+			p = m
+		} else {
+			thing := new(Thing)
+			thing.AddStateHandler(&got)
+			thing.AddNeighbourHandler(&got)
+			thing.AddParentHandler(&got)
+			p = thing
+		}
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, test.data)
+		p.Dispatch(&wl.Event{Opcode: test.opcode, Data: &buf})
+		if len(got) != 1 || got[0] != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+`
+
+func TestStrictDecode(t *testing.T) {
+	runGenerated(t, sample(t), Options{StrictDecode: true}, strictTest, "-run", "StrictDecode")
+}
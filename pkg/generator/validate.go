@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// Request validation checks the arguments of each request before it is
+// sent, so that a request the compositor would answer with a protocol
+// error, killing the connection some time later, fails in the Go call
+// that made it instead: object arguments must not be nil unless the
+// protocol allows it, nor belong to another connection than the proxy
+// the request is sent on, values of enums must be entries of them, and
+// the message must not be larger than libwayland accepts.
+
+// validateRequest returns the code checking the args of req of iface,
+// values giving the Go expression for each by name, or "" if there is
+// nothing to check.  newID is whether the request method also returns
+// a new proxy.
+func (g *Generator) validateRequest(iface string, req protocol.Request, values map[string]string, newID bool) string {
+	ret := "return "
+	if newID {
+		ret += "nil, "
+	}
+	report := func(arg string) func(problem string) string {
+		return func(problem string) string {
+			return fmt.Sprintf("%s&RequestError{%q, %q, %q, %s}\n", ret, iface, req.Name, arg, problem)
+		}
+	}
+
+	var b strings.Builder
+	size := protocol.HeaderSize
+	var varying []string // sizes of the strings and arrays
+	for _, arg := range req.Args {
+		value, ok := values[arg.Name]
+		switch arg.Type {
+		case "string":
+			size += 4
+			varying = append(varying, fmt.Sprintf("(len(%s)+4)&^3", value))
+		case "array":
+			size += 4
+			varying = append(varying, fmt.Sprintf("4*len(%s)", value))
+		case "new_id":
+			size += 4
+			if arg.Interface == "" { // preceded by the interface name and version
+				size += 8
+				varying = append(varying, "(len(iface)+4)&^3")
+			}
+		case "fd":
+		default:
+			size += 4
+		}
+		if !ok {
+			continue
+		}
+
+		switch {
+		case arg.Type == "object" && arg.Interface != "" && arg.AllowNull:
+			fmt.Fprintf(&b, "if %s != nil && %s.Context() != p.Context() {\n%s}\n", value, value,
+				report(arg.Name)(`"belongs to another connection"`))
+		case arg.Type == "object" && arg.Interface != "",
+			arg.Type == "new_id" && arg.Interface == "":
+			fmt.Fprintf(&b, "if %s == nil {\n%s}\n", value, report(arg.Name)(`"is null"`))
+			fmt.Fprintf(&b, "if %s.Context() != p.Context() {\n%s}\n", value,
+				report(arg.Name)(`"belongs to another connection"`))
+		case arg.Enum != "" && (arg.Type == "int" || arg.Type == "uint" || arg.Type == "array"):
+			check := g.enumCheck(iface, arg, report(arg.Name))
+			if check == nil {
+				continue
+			}
+			if arg.Type == "array" {
+				fmt.Fprintf(&b, "for _, v := range %s {\n%s\n}\n", value, check("v"))
+			} else {
+				fmt.Fprintf(&b, "%s\n", check(value))
+			}
+		}
+	}
+	if len(varying) > 0 {
+		fmt.Fprintf(&b, "if size := %d + %s; size > maxMessageSize {\n%s}\n", size, strings.Join(varying, " + "),
+			report("")(`fmt.Sprintf("is %d bytes, more than the %d a message can be", size, maxMessageSize)`))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+var validateRequestsTemplate = `
+// RequestError is a request that breaks the protocol, and so is not
+// sent.  Arg is empty for problems with the request as a whole.
+type RequestError struct {
+	Interface string
+	Request   string
+	Arg       string
+	Problem   string
+}
+
+func (e *RequestError) Error() string {
+	if e.Arg == "" {
+		return fmt.Sprintf("%s.%s %s", e.Interface, e.Request, e.Problem)
+	}
+	return fmt.Sprintf("%s.%s: %s %s", e.Interface, e.Request, e.Arg, e.Problem)
+}
+
+// maxMessageSize is the largest message, header included, libwayland
+// accepts.
+const maxMessageSize = 4096
+`
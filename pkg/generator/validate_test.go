@@ -0,0 +1,48 @@
+package generator
+
+import "testing"
+
+// validateTest sends requests generated with ValidateRequests that
+// break the protocol, checking each fails before it is sent.
+const validateTest = `package sample
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRequests(t *testing.T) {
+	m, thing := new(Manager), new(Thing)
+	tests := []struct {
+		name string
+		send func() error
+		want string
+	}{
+		{"null object", func() error {
+			_, err := m.GetChild(nil, ManagerFormatArgb8888)
+			return err
+		}, "sample_manager.get_child: parent is null"},
+		{"not an entry", func() error {
+			_, err := m.GetChild(thing, 5)
+			return err
+		}, "sample_manager.get_child: format 5 is not a sample_manager.format"},
+		{"long string", func() error {
+			_, err := m.CreateThing(strings.Repeat("x", 4080))
+			return err
+		}, "sample_manager.create_thing is 4100 bytes, more than the 4096 a message can be"},
+		{"long array", func() error {
+			return thing.Attach(make([]int32, 1021), 0, 1)
+		}, "sample_thing.attach is 4100 bytes, more than the 4096 a message can be"},
+	}
+	for _, test := range tests {
+		err := test.send()
+		if _, ok := err.(*RequestError); !ok || err.Error() != test.want {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.want)
+		}
+	}
+}
+`
+
+func TestValidateRequests(t *testing.T) {
+	runGenerated(t, sample(t), Options{ValidateRequests: true}, validateTest, "-run", "ValidateRequests")
+}
@@ -0,0 +1,244 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// WireFile is the name the wire tables emitter writes to, a package of
+// its own under the generated one.
+const WireFile = "wire/wire.go"
+
+// Wire tables describe how every message of a protocol is laid out on
+// the wire, in a package of plain data that a traffic dumper can import
+// without the runtime, or the generated client, to pretty-print what
+// it captures.  Excluded messages are described too, since the opcodes
+// on the wire are those of the protocol.
+
+var wireKinds = map[string]string{
+	"int":    "Int",
+	"uint":   "Uint",
+	"fixed":  "Fixed",
+	"string": "String",
+	"object": "Object",
+	"new_id": "NewID",
+	"array":  "Array",
+	"fd":     "FD",
+}
+
+type (
+	wireInterface struct {
+		Name             string
+		Version          int
+		Requests, Events []wireMessage
+	}
+
+	wireMessage struct {
+		Name  string
+		Since int
+		Args  []wireArg
+	}
+
+	wireArg struct {
+		Name, Kind, Interface, Enum string
+		Nullable                    bool
+	}
+
+	wireEnum struct {
+		Name     string // qualified, as in wl_output.transform
+		BitField bool
+		Entries  []wireEntry
+	}
+
+	wireEntry struct {
+		Name  string
+		Value uint64
+	}
+)
+
+func wireInterfacesOf(prot *protocol.Protocol) []wireInterface {
+	var ifaces []wireInterface
+	for _, iface := range prot.Interfaces {
+		wi := wireInterface{Name: iface.Name, Version: iface.Version}
+		for _, req := range iface.Requests {
+			wi.Requests = append(wi.Requests, wireMessageOf(iface.Name, req.Name, req.Since, req.Args))
+		}
+		for _, ev := range iface.Events {
+			wi.Events = append(wi.Events, wireMessageOf(iface.Name, ev.Name, ev.Since, ev.Args))
+		}
+		ifaces = append(ifaces, wi)
+	}
+	return ifaces
+}
+
+func wireMessageOf(iface, name string, since int, args []protocol.Arg) wireMessage {
+	if since == 0 {
+		since = 1
+	}
+	msg := wireMessage{Name: name, Since: since}
+	for _, arg := range args {
+		enum := arg.Enum
+		if enum != "" && !strings.Contains(enum, ".") {
+			enum = iface + "." + enum
+		}
+		msg.Args = append(msg.Args, wireArg{arg.Name, wireKinds[arg.Type], arg.Interface, enum, arg.AllowNull})
+	}
+	return msg
+}
+
+// wireEnumsOf returns the enums of prot.  Entries whose value is not a
+// number are left out.
+func wireEnumsOf(prot *protocol.Protocol) []wireEnum {
+	var enums []wireEnum
+	for _, iface := range prot.Interfaces {
+		for _, enum := range iface.Enums {
+			e := wireEnum{Name: iface.Name + "." + enum.Name, BitField: enum.BitField}
+			for _, entry := range enum.Entries {
+				if v, err := strconv.ParseUint(entry.Value, 0, 32); err == nil {
+					e.Entries = append(e.Entries, wireEntry{entry.Name, v})
+				}
+			}
+			enums = append(enums, e)
+		}
+	}
+	return enums
+}
+
+// wireFile is the wire tables emitter.
+func wireFile(m *Model) ([]File, error) {
+	var buf bytes.Buffer
+	buf.WriteString(m.Header)
+	data := struct {
+		Protocol   string
+		Interfaces []wireInterface
+		Enums      []wireEnum
+	}{m.Protocol.Name, wireInterfacesOf(m.Protocol), wireEnumsOf(m.Protocol)}
+	if err := wireTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Cannot format %s: %s", WireFile, err)
+	}
+	return []File{{WireFile, src}}, nil
+}
+
+var wireTmpl = template.Must(template.New("WireTemplate").Parse(wireTemplate))
+
+var wireTemplate = `// Package wire describes the wire format of the messages of the
+// {{.Protocol}} wayland protocol, for tools decoding captured
+// traffic.  It is data only, and imports nothing.
+package wire
+
+// A Kind is how an argument is encoded on the wire.  Everything is in
+// 32-bit words, in the byte order of the host.
+type Kind uint8
+
+const (
+	Int    Kind = iota // signed
+	Uint               // unsigned
+	Fixed              // signed 24.8 fixed point
+	String             // length, counting a terminating NUL, then the bytes, padded to a word
+	Object             // object id, 0 for null
+	NewID              // id of the new object; with no Interface, after the interface name as a String and the version as a Uint
+	Array              // length, then the bytes, padded to a word
+	FD                 // nothing: the fd travels as ancillary data
+)
+
+// An Arg is an argument of a message.
+type Arg struct {
+	Name      string
+	Kind      Kind
+	Interface string // of an Object or NewID, if the protocol gives it
+	Enum      string // qualified, as in wl_output.transform, and maybe from another protocol
+	Nullable  bool
+}
+
+// A Message is a request or an event.
+type Message struct {
+	Name  string
+	Since int
+	Args  []Arg
+}
+
+// An Interface has its requests and events indexed by opcode.
+type Interface struct {
+	Name     string
+	Version  int
+	Requests []Message
+	Events   []Message
+}
+
+// An Entry is a named value of an enum.
+type Entry struct {
+	Name  string
+	Value uint32
+}
+
+// An Enum lists the values an Arg with an Enum can take, or for a
+// bitfield the bits it can combine.
+type Enum struct {
+	BitField bool
+	Entries  []Entry
+}
+
+// Protocol is the name of the protocol described.
+const Protocol = {{printf "%q" .Protocol}}
+
+// Interfaces describes the interfaces of the protocol by name.
+var Interfaces = map[string]*Interface{
+{{- range .Interfaces}}
+	{{printf "%q" .Name}}: {
+		Name:    {{printf "%q" .Name}},
+		Version: {{.Version}},
+	{{- if .Requests}}
+		Requests: []Message{
+		{{- range .Requests}}
+			{{template "message" .}}
+		{{- end}}
+		},
+	{{- end}}
+	{{- if .Events}}
+		Events: []Message{
+		{{- range .Events}}
+			{{template "message" .}}
+		{{- end}}
+		},
+	{{- end}}
+	},
+{{- end}}
+}
+
+// Enums describes the enums of the protocol by qualified name.
+var Enums = map[string]*Enum{
+{{- range .Enums}}
+	{{printf "%q" .Name}}: {
+	{{- if .BitField}}
+		BitField: true,
+	{{- end}}
+		Entries: []Entry{
+		{{- range .Entries}}
+			{ {{- printf "%q" .Name}}, {{.Value -}} },
+		{{- end}}
+		},
+	},
+{{- end}}
+}
+{{- define "message" -}}
+{Name: {{printf "%q" .Name}}, Since: {{.Since}}
+{{- if .Args}}, Args: []Arg{
+	{{- range .Args}}
+		{Name: {{printf "%q" .Name}}, Kind: {{.Kind}}
+		{{- if .Interface}}, Interface: {{printf "%q" .Interface}}{{end}}
+		{{- if .Enum}}, Enum: {{printf "%q" .Enum}}{{end}}
+		{{- if .Nullable}}, Nullable: true{{end}}},
+	{{- end}}
+	}{{end}}},
+{{- end}}
+`
@@ -0,0 +1,306 @@
+package protocol
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// An Annotation says about a request, event, argument or enum what the
+// protocol XML cannot, for the generator to act on.  Each field
+// applies to some of them only, as Annotate checks.
+type Annotation struct {
+	GoName    string `json:"go_name,omitempty"`   // of the method, event, field or parameter
+	Element   string `json:"element,omitempty"`   // Go type of the elements of an array: int32 or uint32
+	Unit      string `json:"unit,omitempty"`      // of an int or uint holding a time: ns, us, ms or s
+	Ownership string `json:"ownership,omitempty"` // of an event's fd: owned or borrowed by the handler
+	FourCC    bool   `json:"fourcc,omitempty"`    // of an enum whose values are DRM fourcc codes
+
+	// Rect and Point name the int args of a message to group into a
+	// rectangle (x, y, width and height) or a point (x and y).
+	Rect  []string `json:"rect,omitempty"`
+	Point []string `json:"point,omitempty"`
+
+	Line int `json:"-"` // in the annotation file
+}
+
+// Units are the time units an Annotation can give, spelt out.
+var Units = map[string]string{
+	"ns": "nanoseconds",
+	"us": "microseconds",
+	"ms": "milliseconds",
+	"s":  "seconds",
+}
+
+// Annotations are read from an annotation file, which maps requests,
+// events and enums, as in wl_keyboard.keymap, to what they are
+// annotated with, their arguments' annotations under args:
+//
+//	wl_keyboard.keymap:
+//	  args:
+//	    fd:
+//	      ownership: owned
+//	wl_pointer.motion:
+//	  args:
+//	    time:
+//	      unit: ms
+//	wl_surface.damage:
+//	  rect: x y width height
+//	wl_shm.format:
+//	  fourcc: true
+type Annotations struct {
+	File    string
+	targets []string // wl_keyboard.keymap or wl_keyboard.keymap.fd, in file order
+	byName  map[string]*Annotation
+}
+
+// messageKeys and argKeys are what a message and an argument can be
+// annotated with, and enumKeys what an enum can, in place of a message.
+var (
+	messageKeys = map[string]bool{"go_name": true, "args": true, "rect": true, "point": true}
+	argKeys     = map[string]bool{"go_name": true, "element": true, "unit": true, "ownership": true}
+	enumKeys    = map[string]bool{"fourcc": true}
+)
+
+// ReadAnnotations reads the annotation file named file.
+func ReadAnnotations(file string, data []byte) (*Annotations, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", file, err)
+	}
+	ann := &Annotations{File: file, byName: make(map[string]*Annotation)}
+	errorf := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", file, line, fmt.Sprintf(format, args...))
+	}
+	if root.Keys == nil {
+		return nil, errorf(root.Line, "expected a mapping of requests and events")
+	}
+
+	// read reads the annotation of target from node, returning its
+	// args: if it has any.
+	read := func(target string, node *yamlNode, keys map[string]bool) (*yamlNode, error) {
+		if node.Keys == nil {
+			return nil, errorf(node.Line, "expected what %s is annotated with", target)
+		}
+		a := &Annotation{Line: node.Line}
+		var args *yamlNode
+		for _, key := range node.Keys {
+			value := node.Map[key]
+			if !keys[key] {
+				return nil, errorf(value.Line, "%s cannot be annotated with %s", target, key)
+			}
+			if key == "args" {
+				if value.Keys == nil {
+					return nil, errorf(value.Line, "expected the args of %s", target)
+				}
+				args = value
+				continue
+			}
+			if value.Keys != nil {
+				return nil, errorf(value.Line, "expected a value for %s", key)
+			}
+			switch v := value.Scalar; key {
+			case "go_name":
+				if !token.IsIdentifier(v) {
+					return nil, errorf(value.Line, "go_name %q is not a Go identifier", v)
+				}
+				a.GoName = v
+			case "element":
+				if v != "int32" && v != "uint32" {
+					return nil, errorf(value.Line, "element %q is not int32 or uint32", v)
+				}
+				a.Element = v
+			case "unit":
+				if Units[v] == "" {
+					return nil, errorf(value.Line, "unit %q is not ns, us, ms or s", v)
+				}
+				a.Unit = v
+			case "ownership":
+				if v != "owned" && v != "borrowed" {
+					return nil, errorf(value.Line, "ownership %q is not owned or borrowed", v)
+				}
+				a.Ownership = v
+			case "rect":
+				if a.Rect = strings.Fields(v); len(a.Rect) != 4 {
+					return nil, errorf(value.Line, "rect takes four args, its x, y, width and height, not %q", v)
+				}
+			case "point":
+				if a.Point = strings.Fields(v); len(a.Point) != 2 {
+					return nil, errorf(value.Line, "point takes two args, its x and y, not %q", v)
+				}
+			case "fourcc":
+				if v != "true" {
+					return nil, errorf(value.Line, "fourcc %q is not true", v)
+				}
+				a.FourCC = true
+			}
+		}
+		if a.FourCC && (len(node.Keys) > 1) {
+			return nil, errorf(node.Line, "%s is annotated as an enum, with fourcc, and as a message", target)
+		}
+		ann.targets = append(ann.targets, target)
+		ann.byName[target] = a
+		return args, nil
+	}
+
+	targetKeys := make(map[string]bool) // a message's or an enum's
+	for _, keys := range []map[string]bool{messageKeys, enumKeys} {
+		for key := range keys {
+			targetKeys[key] = true
+		}
+	}
+	for _, msg := range root.Keys {
+		node := root.Map[msg]
+		if strings.Count(msg, ".") != 1 {
+			return nil, errorf(node.Line, "%s is not a request, event or enum, as in wl_keyboard.keymap", msg)
+		}
+		args, err := read(msg, node, targetKeys)
+		if err != nil {
+			return nil, err
+		}
+		if args == nil {
+			continue
+		}
+		for _, arg := range args.Keys {
+			if _, err := read(msg+"."+arg, args.Map[arg], argKeys); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ann, nil
+}
+
+// Annotate attaches ann to the requests, events and arguments of prot
+// it names.  A name for both a request and an event of an interface
+// annotates both.  If a name is not in prot, or an annotation does not
+// suit the argument's type, Annotate fails and leaves prot as it was.
+func Annotate(prot *Protocol, ann *Annotations) error {
+	type target struct {
+		a    *Annotation
+		dest **Annotation
+	}
+	var targets []target
+	for _, name := range ann.targets {
+		a := ann.byName[name]
+		parts := strings.SplitN(name, ".", 3)
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", ann.File, a.Line, fmt.Sprintf(format, args...))
+		}
+
+		if a.FourCC {
+			enum := findEnum(prot, parts[0], parts[1])
+			switch {
+			case enum == nil:
+				return errorf("protocol %s has no enum %s", prot.Name, name)
+			case enum.BitField:
+				return errorf("%s is a bitfield, so its values are not fourcc codes", name)
+			}
+			targets = append(targets, target{a, &enum.Annotation})
+			continue
+		}
+
+		found := 0
+		annotate := func(args []Arg, dest **Annotation, request bool) error {
+			found++
+			if len(parts) == 2 {
+				if err := checkGroups(a, args, ann.byName, name); err != nil {
+					return errorf("%s", err)
+				}
+				targets = append(targets, target{a, dest})
+				return nil
+			}
+			for n := range args {
+				arg := &args[n]
+				if arg.Name != parts[2] {
+					continue
+				}
+				switch {
+				case a.Element != "" && arg.Type != "array":
+					return errorf("%s is %s, not an array, so has no element type", name, arg.Type)
+				case a.Unit != "" && arg.Type != "int" && arg.Type != "uint":
+					return errorf("%s is %s, not an int or uint, so has no unit", name, arg.Type)
+				case a.Ownership != "" && arg.Type != "fd":
+					return errorf("%s is %s, not an fd, so has no ownership", name, arg.Type)
+				case a.Ownership != "" && request:
+					return errorf("%s is the fd of a request, which stays the caller's", name)
+				}
+				targets = append(targets, target{a, &arg.Annotation})
+				return nil
+			}
+			return errorf("%s has no arg %s", strings.Join(parts[:2], "."), parts[2])
+		}
+		for n := range prot.Interfaces {
+			iface := &prot.Interfaces[n]
+			if iface.Name != parts[0] {
+				continue
+			}
+			for m := range iface.Requests {
+				if req := &iface.Requests[m]; req.Name == parts[1] {
+					if err := annotate(req.Args, &req.Annotation, true); err != nil {
+						return err
+					}
+				}
+			}
+			for m := range iface.Events {
+				if ev := &iface.Events[m]; ev.Name == parts[1] {
+					if err := annotate(ev.Args, &ev.Annotation, false); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if found == 0 {
+			return errorf("protocol %s has no request or event %s", prot.Name, strings.Join(parts[:2], "."))
+		}
+	}
+
+	for _, t := range targets {
+		*t.dest = t.a
+	}
+	return nil
+}
+
+// findEnum returns the named enum of the named interface of prot, or
+// nil if there is none.
+func findEnum(prot *Protocol, iface, name string) *Enum {
+	for n := range prot.Interfaces {
+		if prot.Interfaces[n].Name != iface {
+			continue
+		}
+		for m := range prot.Interfaces[n].Enums {
+			if enum := &prot.Interfaces[n].Enums[m]; enum.Name == name {
+				return enum
+			}
+		}
+	}
+	return nil
+}
+
+// checkGroups checks that the args a message's annotation a groups
+// are distinct ints of it, with no names of their own.
+func checkGroups(a *Annotation, args []Arg, byName map[string]*Annotation, msg string) error {
+	grouped := make(map[string]bool)
+	for _, name := range append(append([]string(nil), a.Rect...), a.Point...) {
+		if grouped[name] {
+			return fmt.Errorf("%s groups arg %s twice", msg, name)
+		}
+		grouped[name] = true
+		found := false
+		for _, arg := range args {
+			if arg.Name != name {
+				continue
+			}
+			found = true
+			if arg.Type != "int" {
+				return fmt.Errorf("%s.%s is %s, and only ints are grouped", msg, name, arg.Type)
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s has no arg %s", msg, name)
+		}
+		if argAnn := byName[msg+"."+name]; argAnn != nil && argAnn.GoName != "" {
+			return fmt.Errorf("%s.%s is grouped, so has no go_name of its own", msg, name)
+		}
+	}
+	return nil
+}
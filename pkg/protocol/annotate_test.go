@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadAnnotations(t *testing.T) {
+	data := `# annotations for the core protocol
+wl_keyboard.keymap:
+  args:
+    fd:
+      ownership: owned   # the handler closes it
+wl_pointer.motion:
+  go_name: Move
+  args:
+    time:
+      unit: ms
+      go_name: "When"
+wl_surface.damage:
+  rect: x y width height
+wl_shm.format:
+  fourcc: true
+`
+	ann, err := ReadAnnotations("wl.yaml", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Annotation{
+		"wl_keyboard.keymap":     {Line: 2},
+		"wl_keyboard.keymap.fd":  {Ownership: "owned", Line: 4},
+		"wl_pointer.motion":      {GoName: "Move", Line: 6},
+		"wl_pointer.motion.time": {GoName: "When", Unit: "ms", Line: 9},
+		"wl_surface.damage":      {Rect: []string{"x", "y", "width", "height"}, Line: 12},
+		"wl_shm.format":          {FourCC: true, Line: 14},
+	}
+	if len(ann.byName) != len(want) {
+		t.Errorf("got %d annotations, want %d", len(ann.byName), len(want))
+	}
+	for name, w := range want {
+		if got := ann.byName[name]; got == nil || !reflect.DeepEqual(*got, w) {
+			t.Errorf("%s: got %+v, want %+v", name, got, w)
+		}
+	}
+	order := []string{"wl_keyboard.keymap", "wl_keyboard.keymap.fd", "wl_pointer.motion", "wl_pointer.motion.time",
+		"wl_surface.damage", "wl_shm.format"}
+	if !reflect.DeepEqual(ann.targets, order) {
+		t.Errorf("got targets %v, want %v", ann.targets, order)
+	}
+}
+
+func TestReadAnnotationsErrors(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"not yaml", "- wl_pointer.motion\n",
+			`a.yaml:1: only mappings of scalars are supported, not "- wl_pointer.motion"`},
+		{"not a message", "wl_pointer:\n  go_name: P\n",
+			`a.yaml:1: wl_pointer is not a request, event or enum, as in wl_keyboard.keymap`},
+		{"scalar message", "wl_pointer.motion: Move\n",
+			`a.yaml:1: expected what wl_pointer.motion is annotated with`},
+		{"unknown key", "wl_pointer.motion:\n  colour: red\n",
+			`a.yaml:2: wl_pointer.motion cannot be annotated with colour`},
+		{"old go-name spelling", "wl_pointer.motion:\n  go-name: Move\n",
+			`a.yaml:2: wl_pointer.motion cannot be annotated with go-name`},
+		{"arg key on message", "wl_pointer.motion:\n  unit: ms\n",
+			`a.yaml:2: wl_pointer.motion cannot be annotated with unit`},
+		{"bad go_name", "wl_pointer.motion:\n  go_name: 2d\n",
+			`a.yaml:2: go_name "2d" is not a Go identifier`},
+		{"bad unit", "wl_pointer.motion:\n  args:\n    time:\n      unit: h\n",
+			`a.yaml:4: unit "h" is not ns, us, ms or s`},
+		{"args not a mapping", "wl_pointer.motion:\n  args: time\n",
+			`a.yaml:2: expected the args of wl_pointer.motion`},
+		{"nested value", "wl_pointer.motion:\n  go_name:\n    x: y\n",
+			`a.yaml:2: expected a value for go_name`},
+		{"short rect", "wl_surface.damage:\n  rect: x y\n",
+			`a.yaml:2: rect takes four args, its x, y, width and height, not "x y"`},
+		{"fourcc not true", "wl_shm.format:\n  fourcc: yes\n",
+			`a.yaml:2: fourcc "yes" is not true`},
+	}
+	for _, test := range tests {
+		_, err := ReadAnnotations("a.yaml", []byte(test.in))
+		if err == nil {
+			t.Errorf("%s: no error, want %q", test.name, test.want)
+		} else if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exclude leaves what names names out of prot: an interface, as in
+// wl_shell, or a request or event, as in wl_keyboard.keymap.
+//
+// Opcodes are positions, so excluded requests and events stay where
+// they are, marked Excluded for the generator to skip, along with any
+// TrimSince marked before.  Excluded interfaces are dropped.  If a
+// name is not in prot, or a message that is kept uses an excluded
+// interface, Exclude fails and leaves prot as it was.
+func Exclude(prot *Protocol, names []string) error {
+	ifaces := make(map[string]bool)
+	messages := make(map[string]bool)
+	for _, name := range names {
+		iface, msg := name, ""
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			iface, msg = name[:i], name[i+1:]
+		}
+		found := false
+		for _, in := range prot.Interfaces {
+			if in.Name != iface {
+				continue
+			}
+			found = msg == ""
+			for _, req := range in.Requests {
+				found = found || req.Name == msg
+			}
+			for _, ev := range in.Events {
+				found = found || ev.Name == msg
+			}
+		}
+		if !found {
+			return fmt.Errorf("cannot exclude %s: protocol %s has no such interface, request or event", name, prot.Name)
+		}
+		if msg == "" {
+			ifaces[iface] = true
+		} else {
+			messages[name] = true
+		}
+	}
+
+	// check everything before changing anything
+	uses := func(iface, msg string, excluded bool, args []Arg) error {
+		if excluded || ifaces[iface] || messages[iface+"."+msg] {
+			return nil
+		}
+		for _, arg := range args {
+			if ifaces[arg.Interface] {
+				return fmt.Errorf("cannot exclude %s: %s.%s uses it, and is not excluded", arg.Interface, iface, msg)
+			}
+		}
+		return nil
+	}
+	for _, iface := range prot.Interfaces {
+		for _, req := range iface.Requests {
+			if err := uses(iface.Name, req.Name, req.Excluded, req.Args); err != nil {
+				return err
+			}
+		}
+		for _, ev := range iface.Events {
+			if err := uses(iface.Name, ev.Name, ev.Excluded, ev.Args); err != nil {
+				return err
+			}
+		}
+	}
+
+	var kept []Interface
+	for _, iface := range prot.Interfaces {
+		if ifaces[iface.Name] {
+			continue
+		}
+		for n := range iface.Requests {
+			iface.Requests[n].Excluded = iface.Requests[n].Excluded || messages[iface.Name+"."+iface.Requests[n].Name]
+		}
+		for n := range iface.Events {
+			iface.Events[n].Excluded = iface.Events[n].Excluded || messages[iface.Name+"."+iface.Events[n].Name]
+		}
+		kept = append(kept, iface)
+	}
+	prot.Interfaces = kept
+	return nil
+}
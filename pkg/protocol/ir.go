@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// IRVersion is the version of the IR schema MarshalIR writes, recorded
+// in the IR as "ir_version".
+//
+// Any change to the shape of the IR, even a new optional field, bumps
+// it, so that an older scanner given newer IR says so rather than
+// tripping over a field it does not know.  A change that older IR
+// cannot simply be read as also gets an entry in upgrades, so IR
+// written by any earlier release keeps working.  Every bump also adds
+// testdata/upgrade-irN.json, what the scanner writing version N made
+// of testdata/upgrade.xml, for the upgrade tests.
+const IRVersion = 3
+
+// upgrades[n] rewrites version n of the IR, decoded generically, into
+// version n+1.
+var upgrades = []func(ir map[string]interface{}) error{
+	// 0: IR from before it was versioned reads the same as version 1
+	func(map[string]interface{}) error { return nil },
+	// 1: events gained an optional type (destructor), and messages and
+	// args an optional annotation, which version 1 does without
+	func(map[string]interface{}) error { return nil },
+	// 2: enums gained an optional annotation (fourcc)
+	func(map[string]interface{}) error { return nil },
+}
+
+// ir is the IR as written: the protocol along with its schema version.
+type ir struct {
+	Version int `json:"ir_version"`
+	Protocol
+}
+
+// MarshalIR writes prot as the current version of the IR.
+func MarshalIR(prot *Protocol) ([]byte, error) {
+	data, err := json.MarshalIndent(ir{IRVersion, *prot}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ParseIR reads the JSON intermediate representation, upgrading IR
+// written by older versions of the scanner.  Fields the model does not
+// have are an error, so typos do not go unnoticed.
+func ParseIR(r io.Reader) (*Protocol, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe struct {
+		Version int `json:"ir_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("Cannot decode IR: %w", err)
+	}
+	switch {
+	case probe.Version > IRVersion:
+		return nil, fmt.Errorf("IR version %d is newer than this scanner supports (%d)", probe.Version, IRVersion)
+	case probe.Version < 0:
+		return nil, fmt.Errorf("Bad IR version %d", probe.Version)
+	case probe.Version < IRVersion:
+		if data, err = upgradeIR(data, probe.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc ir
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Cannot decode IR: %w", err)
+	}
+	defaultVersions(&doc.Protocol)
+	return &doc.Protocol, nil
+}
+
+// upgradeIR brings version from of the IR up to IRVersion.
+func upgradeIR(data []byte, from int) ([]byte, error) {
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Cannot decode IR: %w", err)
+	}
+	for v := from; v < IRVersion; v++ {
+		if err := upgrades[v](doc); err != nil {
+			return nil, fmt.Errorf("Cannot upgrade IR from version %d: %w", v, err)
+		}
+	}
+	doc["ir_version"] = IRVersion
+	return json.Marshal(doc)
+}
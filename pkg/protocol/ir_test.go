@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The testdata/upgrade-ir*.json files are what the scanners of each
+// earlier IR version wrote for testdata/upgrade.xml.  Read now, they
+// must come out as the current scanner writes the XML.
+
+func TestParseIRUpgrades(t *testing.T) {
+	xml, err := ioutil.ReadFile(filepath.Join("testdata", "upgrade.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prot, err := Decode("upgrade.xml", xml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := MarshalIR(prot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for v := 0; v < IRVersion; v++ {
+		file := filepath.Join("testdata", fmt.Sprintf("upgrade-ir%d.json", v))
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("IR version %d: %s", v, err)
+			continue
+		}
+		old, err := ParseIR(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		got, err := MarshalIR(old)
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s upgraded to\n%s\nwant\n%s", file, got, want)
+		}
+	}
+}
+
+func TestParseIRErrors(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"newer", fmt.Sprintf(`{"ir_version": %d, "name": "x"}`, IRVersion+1),
+			fmt.Sprintf("IR version %d is newer than this scanner supports (%d)", IRVersion+1, IRVersion)},
+		{"negative", `{"ir_version": -1, "name": "x"}`, "Bad IR version -1"},
+		{"unknown field", `{"ir_version": 1, "name": "x", "colour": "red"}`,
+			`Cannot decode IR: json: unknown field "colour"`},
+		{"not json", `{"name": `, "Cannot decode IR: unexpected end of JSON input"},
+	}
+	for _, test := range tests {
+		_, err := ParseIR(strings.NewReader(test.in))
+		if err == nil {
+			t.Errorf("%s: no error, want %q", test.name, test.want)
+		} else if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// LineCounter maps byte offsets in a document to line numbers.  Offsets
+// must be presented in increasing order.
+type LineCounter struct {
+	data []byte
+	line int
+	last int64
+}
+
+func NewLineCounter(data []byte) *LineCounter {
+	return &LineCounter{data: data, line: 1}
+}
+
+// At returns the line the byte at offset off is on.
+func (c *LineCounter) At(off int64) int {
+	c.line += bytes.Count(c.data[c.last:off], []byte("\n"))
+	c.last = off
+	return c.line
+}
+
+// locateLines fills in the Line of every element decoded into prot by
+// walking the same document again.  Elements are matched up with the
+// decoded structures by their position among their siblings.
+func locateLines(data []byte, prot *Protocol) error {
+	var (
+		dec     = xml.NewDecoder(bytes.NewReader(data))
+		lines   = NewLineCounter(data)
+		stack   []string
+		iface   *Interface
+		args    []Arg
+		entries []Entry
+
+		nIface, nReq, nEv, nEnum, nArg, nEntry int
+	)
+
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, ok := tok.(xml.EndElement); ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line := lines.At(off)
+
+		parent := ""
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		stack = append(stack, se.Name.Local)
+
+		switch {
+		case se.Name.Local == "protocol" && parent == "":
+			prot.Line = line
+		case se.Name.Local == "interface" && parent == "protocol":
+			if nIface < len(prot.Interfaces) {
+				iface = &prot.Interfaces[nIface]
+				iface.Line = line
+			}
+			nIface++
+			nReq, nEv, nEnum = 0, 0, 0
+		case se.Name.Local == "request" && parent == "interface" && iface != nil:
+			if nReq < len(iface.Requests) {
+				iface.Requests[nReq].Line = line
+				args = iface.Requests[nReq].Args
+			}
+			nReq++
+			nArg = 0
+		case se.Name.Local == "event" && parent == "interface" && iface != nil:
+			if nEv < len(iface.Events) {
+				iface.Events[nEv].Line = line
+				args = iface.Events[nEv].Args
+			}
+			nEv++
+			nArg = 0
+		case se.Name.Local == "enum" && parent == "interface" && iface != nil:
+			if nEnum < len(iface.Enums) {
+				iface.Enums[nEnum].Line = line
+				entries = iface.Enums[nEnum].Entries
+			}
+			nEnum++
+			nEntry = 0
+		case se.Name.Local == "arg" && (parent == "request" || parent == "event"):
+			if nArg < len(args) {
+				args[nArg].Line = line
+			}
+			nArg++
+		case se.Name.Local == "entry" && parent == "enum":
+			if nEntry < len(entries) {
+				entries[nEntry].Line = line
+			}
+			nEntry++
+		}
+	}
+}
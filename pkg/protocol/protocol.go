@@ -0,0 +1,154 @@
+// Package protocol is the model of a wayland protocol description, as
+// read from the protocol XML or from the JSON intermediate
+// representation wl-scanner writes.
+package protocol
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// The types double as the JSON intermediate representation.  Line is
+// the line of the element in the XML it was parsed from, or zero.
+type Protocol struct {
+	XMLName     xml.Name    `xml:"protocol" json:"-"`
+	Name        string      `xml:"name,attr" json:"name"`
+	Copyright   string      `xml:"copyright" json:"copyright,omitempty"`
+	Description Description `xml:"description" json:"description"`
+	Interfaces  []Interface `xml:"interface" json:"interfaces"`
+	Line        int         `xml:"-" json:"-"`
+}
+
+type Description struct {
+	XMLName xml.Name `xml:"description" json:"-"`
+	Summary string   `xml:"summary,attr" json:"summary,omitempty"`
+	Text    string   `xml:",chardata" json:"text,omitempty"`
+}
+
+type Interface struct {
+	XMLName     xml.Name    `xml:"interface" json:"-"`
+	Name        string      `xml:"name,attr" json:"name"`
+	Version     int         `xml:"version,attr" json:"version"`
+	Since       int         `xml:"since,attr" json:"since,omitempty"` // maybe in future versions
+	Description Description `xml:"description" json:"description"`
+	Requests    []Request   `xml:"request" json:"requests,omitempty"`
+	Events      []Event     `xml:"event" json:"events,omitempty"`
+	Enums       []Enum      `xml:"enum" json:"enums,omitempty"`
+	Line        int         `xml:"-" json:"-"`
+
+	// Unversioned is set when the interface gave no version of 1 or
+	// more, and so was taken to be version 1.
+	Unversioned bool `xml:"-" json:"-"`
+}
+
+type Request struct {
+	XMLName     xml.Name    `xml:"request" json:"-"`
+	Name        string      `xml:"name,attr" json:"name"`
+	Type        string      `xml:"type,attr" json:"type,omitempty"`
+	Since       int         `xml:"since,attr" json:"since,omitempty"`
+	Description Description `xml:"description" json:"description"`
+	Args        []Arg       `xml:"arg" json:"args,omitempty"`
+	Annotation  *Annotation `xml:"-" json:"annotation,omitempty"`
+	Line        int         `xml:"-" json:"-"`
+	Excluded    bool        `xml:"-" json:"-"` // by Exclude
+}
+
+type Arg struct {
+	XMLName    xml.Name    `xml:"arg" json:"-"`
+	Name       string      `xml:"name,attr" json:"name"`
+	Type       string      `xml:"type,attr" json:"type"`
+	Interface  string      `xml:"interface,attr" json:"interface,omitempty"`
+	Enum       string      `xml:"enum,attr" json:"enum,omitempty"`
+	AllowNull  bool        `xml:"allow-null,attr" json:"allow_null,omitempty"`
+	Summary    string      `xml:"summary,attr" json:"summary,omitempty"`
+	Annotation *Annotation `xml:"-" json:"annotation,omitempty"`
+	Line       int         `xml:"-" json:"-"`
+}
+
+type Event struct {
+	XMLName     xml.Name    `xml:"event" json:"-"`
+	Name        string      `xml:"name,attr" json:"name"`
+	Type        string      `xml:"type,attr" json:"type,omitempty"`
+	Since       int         `xml:"since,attr" json:"since,omitempty"`
+	Description Description `xml:"description" json:"description"`
+	Args        []Arg       `xml:"arg" json:"args,omitempty"`
+	Annotation  *Annotation `xml:"-" json:"annotation,omitempty"`
+	Line        int         `xml:"-" json:"-"`
+	Excluded    bool        `xml:"-" json:"-"` // by Exclude
+}
+
+type Enum struct {
+	XMLName     xml.Name    `xml:"enum" json:"-"`
+	Name        string      `xml:"name,attr" json:"name"`
+	BitField    bool        `xml:"bitfield,attr" json:"bitfield,omitempty"`
+	Since       int         `xml:"since,attr" json:"since,omitempty"`
+	Description Description `xml:"description" json:"description"`
+	Entries     []Entry     `xml:"entry" json:"entries"`
+	Annotation  *Annotation `xml:"-" json:"annotation,omitempty"`
+	Line        int         `xml:"-" json:"-"`
+}
+
+type Entry struct {
+	XMLName xml.Name `xml:"entry" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Value   string   `xml:"value,attr" json:"value"`
+	Summary string   `xml:"summary,attr" json:"summary,omitempty"`
+	Since   int      `xml:"since,attr" json:"since,omitempty"`
+	Line    int      `xml:"-" json:"-"`
+}
+
+// Parse reads protocol XML.
+func Parse(r io.Reader) (*Protocol, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseXML(data)
+}
+
+// IsIR reports whether data, read from the named source, holds the
+// JSON intermediate representation rather than protocol XML.
+func IsIR(name string, data []byte) bool {
+	if strings.HasSuffix(name, ".json") {
+		return true
+	}
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
+
+// Decode reads either protocol XML or the IR, as told apart by IsIR.
+// Only XML sources have line numbers.
+func Decode(name string, data []byte) (*Protocol, error) {
+	if IsIR(name, data) {
+		return ParseIR(bytes.NewReader(data))
+	}
+	return parseXML(data)
+}
+
+func parseXML(data []byte) (*Protocol, error) {
+	var prot Protocol
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&prot); err != nil {
+		return nil, fmt.Errorf("Cannot decode wayland.xml: %w", err)
+	}
+	if err := locateLines(data, &prot); err != nil {
+		return nil, err
+	}
+	defaultVersions(&prot)
+	return &prot, nil
+}
+
+// defaultVersions takes interfaces without a version, which decode as
+// version 0, to be version 1 as libwayland does, marking them
+// Unversioned.
+func defaultVersions(prot *Protocol) {
+	for i := range prot.Interfaces {
+		if iface := &prot.Interfaces[i]; iface.Version < 1 {
+			iface.Version = 1
+			iface.Unversioned = true
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Text strips the indentation the XML gives description and copyright
+// text, keeping blank lines as paragraph breaks.
+func Text(text string) string {
+	var paras []string
+	var cur []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if len(cur) > 0 {
+				paras = append(paras, strings.Join(cur, "\n"))
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, line)
+	}
+	if len(cur) > 0 {
+		paras = append(paras, strings.Join(cur, "\n"))
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// Signature returns the libwayland signature string of a message, as
+// wayland-scanner writes it into wl_message tables.
+func Signature(since int, args []Arg) string {
+	sig := ""
+	if since > 1 {
+		sig = strconv.Itoa(since)
+	}
+	for _, arg := range args {
+		if arg.AllowNull {
+			sig += "?"
+		}
+		switch arg.Type {
+		case "int":
+			sig += "i"
+		case "uint":
+			sig += "u"
+		case "fixed":
+			sig += "f"
+		case "string":
+			sig += "s"
+		case "object":
+			sig += "o"
+		case "new_id":
+			if arg.Interface == "" {
+				sig += "su"
+			}
+			sig += "n"
+		case "array":
+			sig += "a"
+		case "fd":
+			sig += "h"
+		}
+	}
+	return sig
+}
+
+// HeaderSize is the size in bytes of a message header on the wire: the
+// object id, then the opcode and message size.
+const HeaderSize = 8
@@ -0,0 +1,119 @@
+package protocol
+
+import "fmt"
+
+// Trim caps the version of every interface of prot at the version
+// max returns for its name, zero meaning no cap, and drops the
+// requests, events and enum entries added in later versions.
+//
+// Opcodes are positions, so only the messages at the end of an
+// interface can be dropped.  If a message to be dropped comes before
+// one that is kept, Trim fails and leaves prot as it was.
+func Trim(prot *Protocol, max func(iface string) int) error {
+	// check everything before changing anything
+	for _, iface := range prot.Interfaces {
+		if version := max(iface.Name); version > 0 {
+			if _, err := kept(iface.Name, requestsOf(iface), version); err != nil {
+				return err
+			}
+			if _, err := kept(iface.Name, eventsOf(iface), version); err != nil {
+				return err
+			}
+		}
+	}
+
+	for n := range prot.Interfaces {
+		iface := &prot.Interfaces[n]
+		version := max(iface.Name)
+		if version == 0 || iface.Version <= version {
+			continue
+		}
+		iface.Version = version
+		k, _ := kept(iface.Name, requestsOf(*iface), version)
+		iface.Requests = iface.Requests[:k]
+		k, _ = kept(iface.Name, eventsOf(*iface), version)
+		iface.Events = iface.Events[:k]
+
+		for e := range iface.Enums {
+			enum := &iface.Enums[e]
+			var entries []Entry
+			for _, entry := range enum.Entries {
+				if entry.Since <= version {
+					entries = append(entries, entry)
+				}
+			}
+			enum.Entries = entries
+		}
+	}
+	return nil
+}
+
+// TrimSince leaves out the requests and events of every interface of
+// prot whose since is outside the range since returns for its name,
+// zero meaning no bound, so that a client for a fixed compositor
+// baseline has exactly the messages it can use.
+//
+// Unlike Trim, it can leave out messages anywhere in an interface, as
+// Exclude does: they stay where they are, marked Excluded, and keep
+// the opcodes of the others.  Interface versions are left alone.
+func TrimSince(prot *Protocol, since func(iface string) (lo, hi int)) {
+	outside := func(version, lo, hi int) bool {
+		if version == 0 {
+			version = 1
+		}
+		return version < lo || hi > 0 && version > hi
+	}
+	for n := range prot.Interfaces {
+		iface := &prot.Interfaces[n]
+		lo, hi := since(iface.Name)
+		for r := range iface.Requests {
+			if outside(iface.Requests[r].Since, lo, hi) {
+				iface.Requests[r].Excluded = true
+			}
+		}
+		for e := range iface.Events {
+			if outside(iface.Events[e].Since, lo, hi) {
+				iface.Events[e].Excluded = true
+			}
+		}
+	}
+}
+
+// message is what Trim needs to know of a request or event.
+type message struct {
+	what  string
+	since int
+}
+
+func requestsOf(iface Interface) []message {
+	msgs := make([]message, len(iface.Requests))
+	for n, req := range iface.Requests {
+		msgs[n] = message{"request " + req.Name, req.Since}
+	}
+	return msgs
+}
+
+func eventsOf(iface Interface) []message {
+	msgs := make([]message, len(iface.Events))
+	for n, ev := range iface.Events {
+		msgs[n] = message{"event " + ev.Name, ev.Since}
+	}
+	return msgs
+}
+
+// kept returns how many of msgs, which are in opcode order, are in
+// version, or an error if those that are not are not all at the end.
+func kept(iface string, msgs []message, version int) (int, error) {
+	k := len(msgs)
+	for n, m := range msgs {
+		if m.since > version {
+			if k == len(msgs) {
+				k = n
+			}
+		} else if k < n {
+			return 0, fmt.Errorf("cannot trim %s to version %d: %s is since version %d, but %s after it is kept",
+				iface, version, msgs[k].what, msgs[k].since, m.what)
+		}
+	}
+	return k, nil
+}
@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Annotation files are written in a subset of YAML: block mappings,
+// nested by indenting with spaces, of plain or quoted scalars, and
+// comments.  Sequences, flow collections, anchors, tags and block
+// scalars are refused rather than misread.
+
+// A yamlNode is a scalar, or if Keys is not nil a mapping.
+type yamlNode struct {
+	Line   int
+	Scalar string
+	Keys   []string // in the order written
+	Map    map[string]*yamlNode
+}
+
+type yamlLine struct {
+	n, indent int
+	text      string
+}
+
+func parseYAML(data []byte) (*yamlNode, error) {
+	var lines []yamlLine
+	for n, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(text, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed[0] == '#' || (len(lines) == 0 && trimmed == "---") {
+			continue
+		}
+		if trimmed[0] == '\t' {
+			return nil, fmt.Errorf("%d: indent with spaces, not tabs", n+1)
+		}
+		lines = append(lines, yamlLine{n + 1, len(text) - len(trimmed), trimmed})
+	}
+	if len(lines) == 0 {
+		return &yamlNode{Line: 1, Keys: []string{}, Map: map[string]*yamlNode{}}, nil
+	}
+	node, rest, err := parseYAMLMapping(lines, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d: indented less than the lines before it", rest[0].n)
+	}
+	return node, nil
+}
+
+// parseYAMLMapping parses the mapping whose keys are indented by
+// indent, returning the lines after it.
+func parseYAMLMapping(lines []yamlLine, indent int) (*yamlNode, []yamlLine, error) {
+	node := &yamlNode{Line: lines[0].n, Keys: []string{}, Map: make(map[string]*yamlNode)}
+	for len(lines) > 0 && lines[0].indent == indent {
+		l := lines[0]
+		lines = lines[1:]
+		key, value, err := splitYAML(l.text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%d: %s", l.n, err)
+		}
+		if _, dup := node.Map[key]; dup {
+			return nil, nil, fmt.Errorf("%d: %s appears twice", l.n, key)
+		}
+
+		child := &yamlNode{Line: l.n, Scalar: value}
+		if value == "" && len(lines) > 0 && lines[0].indent > indent {
+			child, lines, err = parseYAMLMapping(lines, lines[0].indent)
+			if err != nil {
+				return nil, nil, err
+			}
+			child.Line = l.n
+		}
+		node.Keys = append(node.Keys, key)
+		node.Map[key] = child
+	}
+	if len(lines) > 0 && lines[0].indent > indent {
+		return nil, nil, fmt.Errorf("%d: indented more than the key before it", lines[0].n)
+	}
+	return node, lines, nil
+}
+
+// splitYAML splits a "key: value" line, unquoting both and dropping a
+// comment after the value.
+func splitYAML(text string) (key, value string, err error) {
+	if strings.IndexByte("-[{?&*!|>%@`", text[0]) >= 0 && !(text[0] == '-' && len(text) > 1 && text[1] != ' ') {
+		return "", "", fmt.Errorf("only mappings of scalars are supported, not %q", text)
+	}
+	key, rest, err := yamlScalar(text, true)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+		return "", "", fmt.Errorf("expected \"key: value\", not %q", text)
+	}
+	rest = strings.TrimLeft(rest[1:], " ")
+	if rest == "" || rest[0] == '#' {
+		return key, "", nil
+	}
+	if strings.IndexByte("[{&*!|>%@`", rest[0]) >= 0 {
+		return "", "", fmt.Errorf("only plain and quoted scalar values are supported, not %q", rest)
+	}
+	value, rest, err = yamlScalar(rest, false)
+	if err != nil {
+		return "", "", err
+	}
+	if rest = strings.TrimLeft(rest, " "); rest != "" && rest[0] != '#' {
+		return "", "", fmt.Errorf("unexpected %q after %s", rest, key)
+	}
+	return key, value, nil
+}
+
+// yamlScalar reads a scalar from the start of text, returning what
+// follows it.  A plain key ends at ": " and a plain value at " #".
+func yamlScalar(text string, isKey bool) (scalar, rest string, err error) {
+	switch text[0] {
+	case '"':
+		for i := 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				s, err := strconv.Unquote(text[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("bad quoted string %s", text[:i+1])
+				}
+				return s, text[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string %s", text)
+	case '\'':
+		for i := 1; i < len(text); i++ {
+			if text[i] != '\'' {
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '\'' {
+				i++
+				continue
+			}
+			return strings.Replace(text[1:i], "''", "'", -1), text[i+1:], nil
+		}
+		return "", "", fmt.Errorf("unterminated string %s", text)
+	}
+	end := len(text)
+	if isKey {
+		if i := strings.Index(text+" ", ": "); i >= 0 {
+			end = i
+		}
+	} else if i := strings.Index(text, " #"); i >= 0 {
+		end = i
+	}
+	return strings.TrimRight(text[:end], " "), text[end:], nil
+}
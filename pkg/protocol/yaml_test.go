@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// render writes n compactly, mappings as {key: value, ...} in the
+// order written and scalars quoted, with the line of each mapping
+// value after an @.
+func render(n *yamlNode) string {
+	if n.Keys == nil {
+		return strconv.Quote(n.Scalar)
+	}
+	var entries []string
+	for _, key := range n.Keys {
+		child := n.Map[key]
+		entries = append(entries, strconv.Quote(key)+"@"+strconv.Itoa(child.Line)+": "+render(child))
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "", `{}`},
+		{"only comments", "# nothing\n\n  # here\n", `{}`},
+		{"document start", "---\na: 1\n", `{"a"@2: "1"}`},
+
+		{"plain scalar", "a: hello world\n", `{"a"@1: "hello world"}`},
+		{"no final newline", "a: 1", `{"a"@1: "1"}`},
+		{"trailing space", "a: 1  \r\n", `{"a"@1: "1"}`},
+		{"empty value", "a:\nb: 2\n", `{"a"@1: "", "b"@2: "2"}`},
+		{"colon in value", "a: b:c\n", `{"a"@1: "b:c"}`},
+		{"double quoted", `a: "x \"y\"\tz"`, `{"a"@1: "x \"y\"\tz"}`},
+		{"single quoted", `a: 'it''s'`, `{"a"@1: "it's"}`},
+		{"quoted key", `"a b": c`, `{"a b"@1: "c"}`},
+		{"quoted key with colon", `'a: b': c`, `{"a: b"@1: "c"}`},
+		{"keys in order", "b: 1\na: 2\nc: 3\n", `{"b"@1: "1", "a"@2: "2", "c"@3: "3"}`},
+
+		{"comment after value", "a: 1 # one\n", `{"a"@1: "1"}`},
+		{"comment after key", "a: # none\n", `{"a"@1: ""}`},
+		{"hash in plain value", "a: b#c\n", `{"a"@1: "b#c"}`},
+		{"hash in quoted value", `a: "b # c" # d`, `{"a"@1: "b # c"}`},
+
+		{"nested", "a:\n  b: 1\n  c: 2\nd: 3\n",
+			`{"a"@1: {"b"@2: "1", "c"@3: "2"}, "d"@4: "3"}`},
+		{"deeply nested", "a:\n  b:\n    c:\n      d: 1\n  e: 2\n",
+			`{"a"@1: {"b"@2: {"c"@3: {"d"@4: "1"}}, "e"@5: "2"}}`},
+		{"nested with comments", "a:\n  # about b\n  b: 1\n\n  c: 2 # two\n",
+			`{"a"@1: {"b"@3: "1", "c"@5: "2"}}`},
+		{"any consistent indent", "a:\n     b: 1\n     c: 2\n",
+			`{"a"@1: {"b"@2: "1", "c"@3: "2"}}`},
+		{"indented document", "  a: 1\n  b: 2\n", `{"a"@1: "1", "b"@2: "2"}`},
+	}
+	for _, test := range tests {
+		node, err := parseYAML([]byte(test.in))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := render(node); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"sequence", "- a\n- b\n", `1: only mappings of scalars are supported, not "- a"`},
+		{"nested sequence", "a:\n  - b\n", `2: only mappings of scalars are supported, not "- b"`},
+		{"flow sequence", "a: [b, c]\n", `1: only plain and quoted scalar values are supported, not "[b, c]"`},
+		{"flow mapping", "a: {b: c}\n", `1: only plain and quoted scalar values are supported, not "{b: c}"`},
+		{"anchor", "a: &x b\n", `1: only plain and quoted scalar values are supported, not "&x b"`},
+		{"block scalar", "a: |\n  b\n", `1: only plain and quoted scalar values are supported, not "|"`},
+
+		{"tab indent", "a:\n\tb: 1\n", `2: indent with spaces, not tabs`},
+		{"more indented after value", "a: 1\n  b: 2\n", `2: indented more than the key before it`},
+		{"between levels", "a:\n    b: 1\n  c: 2\n", `3: indented more than the key before it`},
+		{"less than the first line", "  a: 1\nb: 2\n", `2: indented less than the lines before it`},
+
+		{"no colon", "a\n", `1: expected "key: value", not "a"`},
+		{"no space after colon", "a:b\n", `1: expected "key: value", not "a:b"`},
+		{"duplicate key", "a: 1\na: 2\n", `2: a appears twice`},
+		{"duplicate nested key", "a:\n  b: 1\n  b: 2\n", `3: b appears twice`},
+		{"unterminated double", `a: "b`, `1: unterminated string "b`},
+		{"unterminated single", `a: 'b`, `1: unterminated string 'b`},
+		{"bad escape", `a: "\q"`, `1: bad quoted string "\q"`},
+		{"after quoted value", `a: "b" c`, `1: unexpected "c" after a`},
+	}
+	for _, test := range tests {
+		_, err := parseYAML([]byte(test.in))
+		if err == nil {
+			t.Errorf("%s: no error, want %q", test.name, test.want)
+		} else if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
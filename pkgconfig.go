@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pkgConfigFiles are the protocols that pkg-config:PKG names, for the
+// packages that install one.
+var pkgConfigFiles = map[string]string{
+	"wayland-scanner": "wayland.xml",
+}
+
+// pkgConfigPath finds the file a pkg-config: source names in the
+// pkgdatadir of an installed package, as C projects find wayland.xml,
+// so that the generated code matches what is installed.  The source is
+// the package and a path in its pkgdatadir, as in
+// pkg-config:wayland-protocols/stable/xdg-shell/xdg-shell.xml, or just
+// the package, for the protocol it is known to install, or else its
+// whole pkgdatadir.
+func pkgConfigPath(src string) (string, error) {
+	pkg := strings.TrimPrefix(src, "pkg-config:")
+	file := ""
+	if i := strings.IndexByte(pkg, '/'); i >= 0 {
+		pkg, file = pkg[:i], path.Clean(pkg[i+1:])
+		if file == ".." || strings.HasPrefix(file, "../") || path.IsAbs(file) {
+			return "", fmt.Errorf("%s is not in the pkgdatadir of %s", src, pkg)
+		}
+	} else {
+		file = pkgConfigFiles[pkg]
+	}
+	out, err := exec.Command("pkg-config", "--variable=pkgdatadir", pkg).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			if msg := strings.TrimSpace(string(ee.Stderr)); msg != "" {
+				return "", fmt.Errorf("%s: %s", src, msg)
+			}
+			return "", fmt.Errorf("%s: pkg-config cannot find %s (is it installed, and on PKG_CONFIG_PATH?)", src, pkg)
+		}
+		return "", fmt.Errorf("%s: %s", src, err)
+	}
+	dir := strings.TrimSpace(string(out))
+	if dir == "" {
+		return "", fmt.Errorf("%s: %s has no pkgdatadir", src, pkg)
+	}
+	return filepath.Join(dir, filepath.FromSlash(file)), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+var cpuProfile = flag.String("cpuprofile", "", "Write a CPU profile of the scanner to this file")
+var memProfile = flag.String("memprofile", "", "Write a profile of the scanner's memory allocations to this file")
+var traceFile = flag.String("trace", "", "Write an execution trace of the scanner to this file")
+
+// startProfiling starts the profiles the flags ask for, returning a
+// function that stops them and writes them out.  Profiles are written
+// when main returns, so a run that fails writes none.
+func startProfiling() (stop func()) {
+	var stops []func()
+	create := func(name string) *os.File {
+		f, err := os.Create(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return f
+	}
+	closeFile := func(f *os.File) {
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *cpuProfile != "" {
+		f := create(*cpuProfile)
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatalf("-cpuprofile: %s", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			closeFile(f)
+		})
+	}
+	if *traceFile != "" {
+		f := create(*traceFile)
+		if err := trace.Start(f); err != nil {
+			log.Fatalf("-trace: %s", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			closeFile(f)
+		})
+	}
+	if *memProfile != "" {
+		// Check the file can be written before the run rather than after.
+		f := create(*memProfile)
+		stops = append(stops, func() {
+			runtime.GC()
+			if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+				log.Fatalf("-memprofile: %s", err)
+			}
+			closeFile(f)
+		})
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// A progress reports on the packages of a run as each is generated,
+// and sums them up at the end, for -progress.
+type progress struct {
+	format string // "text" or "json"
+	total  int
+	start  time.Time
+
+	mu   sync.Mutex
+	done int
+}
+
+// protocolProgress is what is reported of each package.
+type protocolProgress struct {
+	Protocol   string  `json:"protocol"`
+	Package    string  `json:"pkg"`
+	Output     string  `json:"output"`
+	Interfaces int     `json:"interfaces"`
+	Seconds    float64 `json:"seconds"`
+	Failed     bool    `json:"failed,omitempty"`
+}
+
+func newProgress(format string, total int) *progress {
+	if *quiet {
+		return nil
+	}
+	switch format {
+	case "":
+		return nil
+	case "text", "json":
+	default:
+		log.Fatalf("-progress: unknown format %q (want text or json)", format)
+	}
+	return &progress{format: format, total: total, start: time.Now()}
+}
+
+func (j *job) progress() protocolProgress {
+	return protocolProgress{
+		Protocol:   j.prot.Name,
+		Package:    j.Package,
+		Output:     j.Output,
+		Interfaces: len(j.prot.Interfaces),
+		Seconds:    j.elapsed.Seconds(),
+		Failed:     j.err != nil,
+	}
+}
+
+// finished reports that j has been generated.  It may be called from
+// several workers at once.
+func (p *progress) finished(j *job) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	pp := j.progress()
+	if p.format == "json" {
+		data, _ := json.Marshal(pp)
+		fmt.Fprintf(os.Stderr, "%s\n", data)
+		return
+	}
+	status := ""
+	if pp.Failed {
+		status = ", failed"
+	}
+	fmt.Fprintf(os.Stderr, "[%d/%d] %s (%s): %d interfaces in %s%s\n",
+		p.done, p.total, pp.Protocol, pp.Package, pp.Interfaces, round(j.elapsed), status)
+}
+
+// summary reports on all the jobs, in order, once they are done.
+func (p *progress) summary(jobs []*job) {
+	if p == nil {
+		return
+	}
+	wall := time.Since(p.start)
+	if p.format == "json" {
+		var sum struct {
+			Protocols []protocolProgress `json:"protocols"`
+			Seconds   float64            `json:"seconds"`
+		}
+		for _, j := range jobs {
+			sum.Protocols = append(sum.Protocols, j.progress())
+		}
+		sum.Seconds = wall.Seconds()
+		data, _ := json.Marshal(sum)
+		fmt.Fprintf(os.Stderr, "%s\n", data)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stderr, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "PROTOCOL\tPACKAGE\tINTERFACES\tTIME\tOUTPUT\n")
+	ifaces := 0
+	for _, j := range jobs {
+		pp := j.progress()
+		ifaces += pp.Interfaces
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", pp.Protocol, pp.Package, pp.Interfaces, round(j.elapsed), pp.Output)
+	}
+	fmt.Fprintf(w, "%d protocols\t\t%d\t%s\n", len(jobs), ifaces, round(wall))
+	w.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
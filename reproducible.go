@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+)
+
+// checkReproducible generates everything a second time, into a
+// scratch directory, by running this binary again with the same flags,
+// and fails unless every file, in subdirectories such as wire/ too,
+// comes out byte for byte the same as the first time.
+func checkReproducible(dest string) {
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "wl-scanner")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// where each file in the scratch directory was written the first time
+	original := map[string]string{}
+
+	// The output is named afresh, so that it lands in the scratch
+	// directory, and the sidecar and changelog are left as the first run
+	// wrote them.
+	args := withoutFlags(os.Args[1:], "check-reproducible", "output", "output-template", "sidecar", "changelog")
+	args = append(args, "-output", filepath.Join(dir, filepath.Base(dest)))
+	original[filepath.Base(dest)] = dest
+	if *manifest != "" {
+		args = append(args, "-manifest", filepath.Join(dir, "manifest.json"))
+		original["manifest.json"] = *manifest
+	}
+
+	cmd := exec.Command(self, args...)
+	cmd.Env = append(os.Environ(), commandEnv+"="+commandLine())
+	cmd.Stderr = ioutil.Discard
+	if err := cmd.Run(); err != nil {
+		log.Fatalf("regenerating: %s", err)
+	}
+
+	differ := 0
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if name == generator.GoModFile {
+			return nil // an existing go.mod is left alone, so need not match
+		}
+		again, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		first, ok := original[name]
+		if !ok {
+			first = filepath.Join(filepath.Dir(dest), name)
+		}
+		before, err := ioutil.ReadFile(first)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(before, again) {
+			printDiagnostic(Diagnostic{File: first, Severity: severityError, Rule: "not-reproducible", Message: "differs when generated again"})
+			differ++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if differ > 0 {
+		log.Fatalf("output is not reproducible")
+	}
+}
+
+// withoutFlags returns args less the flags named in drop, and the
+// values of those that take one.
+func withoutFlags(args []string, drop ...string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return append(kept, args[i:]...) // the flags end here
+		}
+		flagArgs := args[i : i+1]
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if f := flag.Lookup(name); f != nil && !isBoolFlag(f) && !strings.Contains(arg, "=") && i+1 < len(args) {
+			flagArgs = args[i : i+2]
+			i++
+		}
+		dropped := false
+		for _, d := range drop {
+			dropped = dropped || name == d
+		}
+		if !dropped {
+			kept = append(kept, flagArgs...)
+		}
+	}
+	return kept
+}
+
+// isBoolFlag reports whether f is set without a value, as -strict.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// commandEnv carries the original command line into the second run
+// made by -check-reproducible, which is given a different -output.
+const commandEnv = "WL_SCANNER_COMMAND"
+
+// commandLine is the command line -header templates see.
+func commandLine() string {
+	if cmd := os.Getenv(commandEnv); cmd != "" {
+		return cmd
+	}
+	return strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+}
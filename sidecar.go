@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+)
+
+// A sidecar records, for audits, exactly what each output of a run was
+// generated from.
+type sidecar struct {
+	Tool    string            `json:"tool_sha256"` // of the scanner binary
+	Flags   map[string]string `json:"flags"`       // those given on the command line
+	Outputs []sidecarOutput   `json:"outputs"`
+}
+
+type sidecarOutput struct {
+	Source   string        `json:"source"`
+	URL      string        `json:"url,omitempty"` // a remote source was fetched from, after mirrors and redirects
+	SHA256   string        `json:"source_sha256"`
+	Package  string        `json:"pkg"`
+	Unstable string        `json:"unstable,omitempty"`
+	Files    []sidecarFile `json:"files"`
+}
+
+type sidecarFile struct {
+	Name   string `json:"name"` // relative to the sidecar
+	SHA256 string `json:"sha256"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeSidecar writes the -sidecar file for jobs, once their files
+// are in place.
+func writeSidecar(file string, jobs []*job) {
+	tool, err := ioutil.ReadFile(executable())
+	if err != nil {
+		log.Fatal(err)
+	}
+	rec := sidecar{
+		Tool:  sha256Hex(tool),
+		Flags: make(map[string]string),
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "sidecar" {
+			rec.Flags[f.Name] = f.Value.String()
+		}
+	})
+
+	dir := filepath.Dir(file)
+	for _, j := range jobs {
+		out := sidecarOutput{
+			Source:   j.Source,
+			SHA256:   j.sourceSum,
+			Package:  j.Package,
+			Unstable: j.Unstable,
+		}
+		if isRemote(j.Source) {
+			out.URL = j.sourceURL
+		}
+		for _, f := range j.written {
+			name, err := filepath.Rel(dir, f.dest)
+			if err != nil {
+				name = f.dest
+			}
+			out.Files = append(out.Files, sidecarFile{filepath.ToSlash(name), f.sum})
+		}
+		rec.Outputs = append(rec.Outputs, out)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, append(data, '\n'), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
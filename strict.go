@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
+)
+
+// modelElement records which attributes and child elements the
+// scanner decodes for one element type.
+type modelElement struct {
+	attrs    map[string]bool
+	children map[string]*modelElement
+}
+
+// modelSchema derives the elements and attributes the scanner
+// understands from the xml tags on the Protocol types, so it cannot
+// drift from what the protocol package actually keeps.
+func modelSchema() *modelElement {
+	return schemaOf(reflect.TypeOf(Protocol{}))
+}
+
+func schemaOf(t reflect.Type) *modelElement {
+	el := &modelElement{
+		attrs:    make(map[string]bool),
+		children: make(map[string]*modelElement),
+	}
+	if t.Kind() != reflect.Struct {
+		return el
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("xml")
+		if tag == "" || tag == "-" || f.Name == "XMLName" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		switch {
+		case len(parts) > 1 && parts[1] == "attr":
+			el.attrs[parts[0]] = true
+		case parts[0] == "":
+			// chardata, innerxml and the like
+		default:
+			ft := f.Type
+			if ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+			}
+			el.children[parts[0]] = schemaOf(ft)
+		}
+	}
+	return el
+}
+
+// checkStrict reports every element and attribute in data that the
+// scanner would silently drop while decoding.
+func checkStrict(file string, data []byte) []Diagnostic {
+	var (
+		diags  []Diagnostic
+		dec    = xml.NewDecoder(bytes.NewReader(data))
+		lines  = protocol.NewLineCounter(data)
+		schema = modelSchema()
+		stack  []*modelElement
+	)
+	errorf := func(rule string, line int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Line:     line,
+			Severity: severityError,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return diags
+		}
+		if err != nil {
+			errorf("strict-syntax", lines.At(off), "%s", err)
+			return diags
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			line := lines.At(off)
+			name := tok.Name.Local
+
+			var el *modelElement
+			if len(stack) == 0 {
+				if name == "protocol" {
+					el = schema
+				}
+			} else {
+				el = stack[len(stack)-1].children[name]
+			}
+			if el == nil {
+				errorf("unsupported-element", line, "element <%s> is not supported by wl-scanner", name)
+				if err := dec.Skip(); err != nil {
+					errorf("strict-syntax", line, "%s", err)
+					return diags
+				}
+				continue
+			}
+
+			for _, attr := range tok.Attr {
+				if !el.attrs[attr.Name.Local] {
+					errorf("unsupported-attribute", line, "attribute %q on <%s> is not supported by wl-scanner",
+						attr.Name.Local, name)
+				}
+			}
+			stack = append(stack, el)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// versionDiags reports the interfaces of prot that were taken to be
+// version 1 for want of a version: as warnings, or under -strict as
+// errors.
+func versionDiags(file string, prot *Protocol) []Diagnostic {
+	severity := severityWarning
+	if *strict {
+		severity = severityError
+	}
+	var diags []Diagnostic
+	for _, iface := range prot.Interfaces {
+		if iface.Unversioned {
+			diags = append(diags, Diagnostic{
+				File:     file,
+				Line:     iface.Line,
+				Severity: severity,
+				Rule:     "missing-version",
+				Message:  fmt.Sprintf("interface %s has no version, so is taken to be version 1", iface.Name),
+			})
+		}
+	}
+	return diags
+}
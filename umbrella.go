@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"log"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+)
+
+// The umbrella package re-exports the entry points of every package of
+// a run, so that an application can import one package for the whole
+// suite of protocols it speaks.
+type (
+	umbrellaData struct {
+		Package    string
+		Imports    []umbrellaImport
+		WL         string // the alias of the wl runtime
+		Globals    []umbrellaGlobal
+		Protocols  []umbrellaProtocol
+		Descriptor bool
+	}
+
+	umbrellaImport struct {
+		Alias, Path string
+	}
+
+	umbrellaGlobal struct {
+		Name    string // of the wrapper, after the full interface name
+		WlName  string
+		Type    string // qualified Go type
+		Bind    string // package-qualified call binding it, less arguments
+		Version int
+		Method  bool // Bind is a method of the wl registry
+	}
+
+	umbrellaProtocol struct {
+		Package    string
+		Name       string
+		Interfaces []umbrellaInterface
+	}
+
+	umbrellaInterface struct {
+		Name    string
+		Version int
+	}
+)
+
+// umbrellaJob generates the -umbrella package for jobs, as a job whose
+// file is ready to stage.
+func umbrellaJob(jobs []*job) *job {
+	data := umbrellaData{
+		Package:    filepath.Base(*umbrellaDir),
+		Descriptor: *descriptor,
+	}
+	if !*binders && !*descriptor {
+		log.Fatal("-umbrella re-exports the -binders and -descriptor of the packages, so needs at least one of them")
+	}
+	if !token.IsIdentifier(data.Package) {
+		log.Fatalf("-umbrella %s: the package is named after the directory, and %q is not a Go identifier", *umbrellaDir, data.Package)
+	}
+
+	aliases := make(map[string]string) // by import path
+	used := make(map[string]bool)
+	alias := func(pkg, path string) string {
+		if a, ok := aliases[path]; ok {
+			return a
+		}
+		a := pkg
+		for n := 2; used[a]; n++ {
+			a = fmt.Sprintf("%s%d", pkg, n)
+		}
+		aliases[path], used[a] = a, true
+		data.Imports = append(data.Imports, umbrellaImport{a, path})
+		return a
+	}
+	data.WL = alias("wl", runtimeImport)
+
+	for _, j := range jobs {
+		if j.Import == "" {
+			log.Fatalf("-umbrella needs the import path of every package, and %s has none", j.Source)
+		}
+		opts := generator.Options{Package: j.Package, Unstable: j.Unstable}
+		a := alias(j.Package, j.Import)
+
+		if *binders {
+			for _, wlName := range generator.Globals(j.prot) {
+				g := umbrellaGlobal{
+					Name:   wrapperName(strings.TrimSuffix(wlName, "_"+j.Unstable)),
+					WlName: wlName,
+					Type:   a + "." + opts.TypeName(wlName),
+				}
+				for _, iface := range j.prot.Interfaces {
+					if iface.Name == wlName {
+						g.Version = iface.Version
+					}
+				}
+				if j.Package == "wl" {
+					g.Bind, g.Method = "Bind"+opts.TypeName(wlName), true
+				} else {
+					g.Bind = a + ".Bind" + opts.TypeName(wlName)
+				}
+				data.Globals = append(data.Globals, g)
+			}
+		}
+		if *descriptor {
+			p := umbrellaProtocol{Package: j.Package, Name: j.prot.Name}
+			for _, iface := range j.prot.Interfaces {
+				p.Interfaces = append(p.Interfaces, umbrellaInterface{iface.Name, iface.Version})
+			}
+			data.Protocols = append(data.Protocols, p)
+		}
+	}
+	if len(data.Globals) == 0 {
+		data.Imports = nil // only the binders use the packages
+	}
+
+	var buf bytes.Buffer
+	if err := umbrellaTemplate.Execute(&buf, data); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("Cannot format the -umbrella package: %s", err)
+	}
+	name := data.Package + ".go"
+	return &job{
+		Source: "-umbrella",
+		Output: filepath.Join(*umbrellaDir, name),
+		files:  []generator.File{{Name: name, Data: src}},
+	}
+}
+
+// wrapperName names an umbrella wrapper after a whole interface name,
+// as in XdgWmBase, so that the wrappers of different packages differ.
+func wrapperName(wlName string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(wlName, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+var umbrellaTemplate = template.Must(template.New("umbrella").Parse(`// package {{.Package}} gathers the packages generated along with it.
+
+// generated by wl-scanner
+// https://github.com/dkolbly/wl-scanner
+package {{.Package}}
+{{- if .Imports}}
+
+import (
+{{- range .Imports}}
+	{{.Alias}} {{printf "%q" .Path}}
+{{- end}}
+)
+{{- end}}
+{{- $wl := .WL}}
+{{- if .Globals}}
+
+// Globals maps the interface name of every global of the packages to
+// the highest version of it they support.
+var Globals = map[string]uint32{
+{{- range .Globals}}
+	{{printf "%q" .WlName}}: {{.Version}},
+{{- end}}
+}
+
+// Bind binds a global the registry announced, at the highest version
+// both the compositor and its package support, as the proxy type of
+// its package.  It returns nil and no error for a global of none of
+// the packages.
+func Bind(r *{{$wl}}.Registry, global {{$wl}}.RegistryGlobalEvent) ({{$wl}}.Proxy, error) {
+	switch global.Interface {
+{{- range .Globals}}
+	case {{printf "%q" .WlName}}:
+		p, err := Bind{{.Name}}(r, global.Name, minVersion(global.Version, {{.Version}}))
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+{{- end}}
+	}
+	return nil, nil
+}
+
+func minVersion(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+{{- range .Globals}}
+
+// Bind{{.Name}} binds the {{.WlName}} global with the given name, as
+// announced by the registry's global event, at version.
+func Bind{{.Name}}(r *{{$wl}}.Registry, name, version uint32) (*{{.Type}}, error) {
+	{{- if .Method}}
+	return r.{{.Bind}}(name, version)
+	{{- else}}
+	return {{.Bind}}(r, name, version)
+	{{- end}}
+}
+{{- end}}
+{{- end}}
+{{- if .Descriptor}}
+
+// ProtocolInfo names a protocol, the package generated from it, and
+// the interfaces of it the package supports.
+type ProtocolInfo struct {
+	Package    string
+	Name       string
+	Interfaces []ProtocolInterface
+}
+
+// ProtocolInterface is an interface and the highest version of it
+// supported.
+type ProtocolInterface struct {
+	Name    string
+	Version int
+}
+
+// Protocols describes every package, as its own Protocol does.
+var Protocols = []ProtocolInfo{
+{{- range .Protocols}}
+	{
+		Package: {{printf "%q" .Package}},
+		Name:    {{printf "%q" .Name}},
+		Interfaces: []ProtocolInterface{
+		{{- range .Interfaces}}
+			{ {{- printf "%q" .Name}}, {{.Version -}} },
+		{{- end}}
+		},
+	},
+{{- end}}
+}
+{{- end}}
+`))
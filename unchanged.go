@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// outputFlags say where to write, or how to get there, but not what;
+// they are left out of the inputs hash so that moving the output does
+// not count as a change.
+var outputFlags = map[string]bool{
+	"output":             true,
+	"manifest":           true,
+	"changelog":          true,
+	"config":             true,
+	"jobs":               true,
+	"fetch-jobs":         true,
+	"check-reproducible": true,
+	"skip-unchanged":     true,
+	"cpuprofile":         true,
+	"memprofile":         true,
+	"trace":              true,
+}
+
+// inputsHash hashes everything the output of jobs depends on: the
+// scanner itself, the flags and the files they name, and every
+// package's settings and source.  All the jobs of a -config run share
+// one hash, since each package's code depends on the names of the
+// others.
+func inputsHash(jobs []*job) string {
+	h := sha256.New()
+	hashFile(h, executable())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !outputFlags[f.Name] {
+			fmt.Fprintf(h, "-%s=%s\n", f.Name, f.Value)
+		}
+	})
+	if *header != "" {
+		hashFile(h, *header)
+	}
+	for _, file := range templates {
+		hashFile(h, file)
+	}
+	for _, j := range jobs {
+		fmt.Fprintf(h, "%s %s %s %s %s %t\n", j.Source, j.Package, j.Unstable, j.Import, j.Module, j.Manifest != "")
+		fmt.Fprintf(h, "%q %q %q %q\n", j.Exclude, j.Imports, j.snippet, j.snippets)
+		if j.Annotations != "" {
+			hashFile(h, j.Annotations)
+		}
+		fmt.Fprintf(h, "%d\n", len(j.data))
+		h.Write(j.data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func executable() string {
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return self
+}
+
+func hashFile(h io.Writer, file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "%s\n", file)
+	if _, err := io.Copy(h, f); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// unchanged reports whether the output of every job was generated from
+// inputs with the hash sum, so that generating again would change
+// nothing.
+func unchanged(jobs []*job, sum string) bool {
+	if !emitKinds()["client"] {
+		return false // nothing to find the hash in
+	}
+	for _, j := range jobs {
+		data, err := ioutil.ReadFile(j.Output)
+		if err != nil || !bytes.Contains(data, []byte("\n// inputs: sha256 "+sum+"\n")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+)
+
+// vendorFile is the -vendor-xml emitter: a copy of the protocol XML as
+// fetched, and its SHA-256 in the format of sha256sum, so the copy can
+// be checked with sha256sum -c.
+func vendorFile(m *generator.Model) ([]generator.File, error) {
+	name := m.Protocol.Name + ".xml"
+	sum := generator.File{
+		Name: name + ".sha256",
+		Data: []byte(fmt.Sprintf("%s  %s\n", sha256Hex(m.Options.SourceData), name)),
+	}
+	if *embedXML {
+		return []generator.File{sum}, nil // -embed-xml copies the XML already
+	}
+	return []generator.File{{Name: name, Data: m.Options.SourceData}, sum}, nil
+}
@@ -2,634 +2,927 @@ package main
 
 import (
 	"bytes"
-	"encoding/xml"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
+
+	"github.com/dkolbly/wl-scanner/pkg/generator"
+	"github.com/dkolbly/wl-scanner/pkg/protocol"
 )
 
-var source = flag.String("source", "", "Where to get the XML from")
+var source = flag.String("source", "", "Where to get the XML (or JSON IR) from")
+var fetchTimeout = flag.Duration("fetch-timeout", 30*time.Second, "How long to wait for a remote source before giving up on it, or trying the next -mirror")
+var fetchJobs = flag.Int("fetch-jobs", 8, "Number of remote sources of a -config to download at once")
+var mirrors stringList
 var output = flag.String("output", "", "Where to put the output go file")
+var importBase = flag.String("import", "", "Go import path of the -output directory, when -source is a wayland-protocols checkout (default from its go.mod)")
+var selectProtocols = flag.String("protocols", "", "Comma separated patterns selecting the protocols of a checkout to generate (e.g., 'stable/*,xdg-*')")
+var outputTemplate = flag.String("output-template", "", "Template naming the output go file after the protocol, instead of -output (e.g., '{{.Protocol}}_client.go')")
 var pkgName = flag.String("pkg", "wl", "Name of the package")
 var unstable = flag.String("unstable", "", "Unstable suffix name to strip (e.g., v6)")
+var metrics = flag.Bool("metrics", false, "Instrument the generated code with Prometheus metrics")
+var validate = flag.Bool("validate", false, "Validate the input against the Wayland DTD")
+var strict = flag.Bool("strict", false, "Fail on elements and attributes the scanner does not understand")
+var werror = flag.Bool("Werror", false, "Treat warnings as errors")
+var diagFormat = flag.String("diagnostics-format", "text", "How to print errors and warnings: text, or json for one object per line")
+var quiet = flag.Bool("q", false, "Print nothing but errors")
+var embedXML = flag.Bool("embed-xml", false, "Copy the protocol XML next to the output and embed it in the generated package")
+var vendorXML = flag.Bool("vendor-xml", false, "Copy the protocol XML as fetched next to the output, with a file recording its SHA-256")
+var header = flag.String("header", "", "Template file for a header to put at the top of every generated file")
+var reproducible = flag.Bool("reproducible", false, "Record the protocol name, version and hash instead of the source path and time")
+var sidecarPath = flag.String("sidecar", "", "Where to write a JSON record of the sources, hashes and flags every output was generated from")
+var skipUnchanged = flag.Bool("skip-unchanged", false, "Record a hash of the inputs in the output, and do nothing if the output already has the same hash")
+var checkRepro = flag.Bool("check-reproducible", false, "Generate a second time and fail unless the output is identical")
+var spdx = flag.String("spdx", "", "SPDX license expression to put at the top of generated files (e.g., MIT)")
+var license = flag.String("license", "", "Name of a file (e.g., LICENSE or NOTICE) to write the protocol copyright to, next to the output")
+var copyrightHeader = flag.Bool("copyright-header", false, "Put the protocol copyright at the top of the generated file")
+var annotations = flag.String("annotations", "", "YAML file annotating the protocol's requests, events and arguments")
+var stats = flag.Bool("stats", false, "Sum up the interfaces, requests and events generated in a comment at the top of the output")
+var noDocs = flag.Bool("no-docs", false, "Leave the comments taken from the protocol's descriptions out of the generated file")
+var docGo = flag.Bool("doc-go", false, "Write a doc.go with an overview of the protocol next to the output")
+var wireTables = flag.Bool("wire-tables", false, "Write a data-only package under the output, in wire/, describing how every message is laid out on the wire")
+var metadata = flag.Bool("metadata", false, "Generate introspection metadata tables for every interface")
+var manifest = flag.String("manifest", "", "Where to put a JSON index of the generated Go symbols")
+var module = flag.String("module", "", "Module path for a go.mod to write next to the output, unless there is one already")
+var runtimeVersion = flag.String("runtime-version", "", "Version of github.com/dkolbly/wl for the -module go.mod to require")
+var parallel = flag.Int("jobs", runtime.NumCPU(), "Number of -config packages to generate at once")
+var emit = flag.String("emit", "client", "What to generate from the protocol, comma separated: client (the Go package), docs (Markdown) and ir (JSON)")
+var progressFormat = flag.String("progress", "", "Report each package as it is generated, and sum up at the end: text or json")
+var umbrellaDir = flag.String("umbrella", "", "Directory to generate a package into that re-exports the -binders and -descriptor of every package of a -config or checkout")
+var changelog = flag.String("changelog", "", "Where to write a Markdown list of the changes to the generated API since the output was last generated")
+var config = flag.String("config", "", "JSON file listing several protocols to generate in one run")
+var templates stringList
+var middleware = flag.Bool("middleware", false, "Route event dispatch and request sends through a middleware chain")
+var binders = flag.Bool("binders", false, "Generate helpers binding each global interface from the registry")
+var enumNames = flag.Bool("enum-names", false, "Generate a function returning the name of a value of each enum")
+var messageNames = flag.Bool("message-names", false, "Give every proxy type methods returning the names of its requests and events by opcode")
+var descriptor = flag.Bool("descriptor", false, "Generate a Protocol value naming the protocol and its interface versions")
+var wait = flag.Bool("wait", false, "Generate a method per event that waits for the next one")
+var filters = flag.Bool("filters", false, "Generate Add...HandlerFiltered methods taking a predicate on events")
+var queue = flag.Int("queue", 0, "Queue up to this many events per proxy for Poll to deliver, rather than delivering them on dispatch (0 for no queue)")
+var clone = flag.Bool("clone", false, "Give every event type a Clone method copying its arrays, for events kept past their handler")
+var jsonEvents = flag.Bool("json", false, "Give every event type MarshalJSON and UnmarshalJSON methods, writing enums by name and proxies as object ids")
+var guardDestroyed = flag.Bool("guard-destroyed", false, "Fail requests with ErrProxyDestroyed once a destructor has been sent")
+var release = flag.Bool("release", false, "Give the proxies of interfaces without a destructor request a Release method unregistering them locally")
+var trackObjects = flag.Bool("track-objects", false, "Count the live proxies of each interface, and generate DebugLiveObjects to report them")
+var strictDecode = flag.Bool("strict-decode", false, "Check events against the protocol as they are decoded, reporting rather than delivering those that break it")
+var validateRequests = flag.Bool("validate-requests", false, "Check the arguments of requests before sending them, failing those that break the protocol with a RequestError")
+var goVersion = flag.String("go", "", "Oldest Go the generated code must build with, as in 1.21, deciding the language features it uses (default 1.16)")
+var dispatchTable = flag.Int("dispatch-table", 0, "Dispatch events through an opcode-indexed table for interfaces with at least this many events (0 for never)")
+
+// The protocol model lives in pkg/protocol so that other tools can
+// parse protocols without going through the scanner.
+type (
+	Protocol    = protocol.Protocol
+	Description = protocol.Description
+	Interface   = protocol.Interface
+	Request     = protocol.Request
+	Arg         = protocol.Arg
+	Event       = protocol.Event
+	Enum        = protocol.Enum
+	Entry       = protocol.Entry
+)
 
-// xml types
-type Protocol struct {
-	XMLName    xml.Name    `xml:"protocol"`
-	Name       string      `xml:"name,attr"`
-	Copyright  string      `xml:"copyright"`
-	Interfaces []Interface `xml:"interface"`
+func init() {
+	flag.Var(&templates, "template", "Template to render over the protocol into a file named after it, less .tmpl (repeatable)")
+	flag.Var(&mirrors, "mirror", "URL to fetch the -source from if it cannot be fetched (repeatable, tried in order)")
+	flag.Var(&maxVersion, "max-version", "Cap interface versions, dropping newer messages: a version for all interfaces and/or iface=version, comma separated (e.g., 4,wl_seat=7)")
+	flag.Var(&sinceRange, "since", "Leave out the requests and events whose since is not in a range: lo-hi, lo- or -hi, for all interfaces and/or iface=range, comma separated (e.g., 1-4,wl_seat=-7)")
 }
 
-type Description struct {
-	XMLName xml.Name `xml:"description"`
-	Summary string   `xml:"summary,attr"`
-	Text    string   `xml:",chardata"`
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-type Interface struct {
-	XMLName     xml.Name    `xml:"interface"`
-	Name        string      `xml:"name,attr"`
-	Version     int         `xml:"version,attr"`
-	Since       int         `xml:"since,attr"` // maybe in future versions
-	Description Description `xml:"description"`
-	Requests    []Request   `xml:"request"`
-	Events      []Event     `xml:"event"`
-	Enums       []Enum      `xml:"enum"`
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
 }
 
-type Request struct {
-	XMLName     xml.Name    `xml:"request"`
-	Name        string      `xml:"name,attr"`
-	Type        string      `xml:"type,attr"`
-	Since       int         `xml:"since,attr"`
-	Description Description `xml:"description"`
-	Args        []Arg       `xml:"arg"`
+// versionCaps is a flag giving the highest version to generate of
+// every interface, or of the interfaces it names.
+type versionCaps struct {
+	all   int
+	iface map[string]int
 }
 
-type Arg struct {
-	XMLName   xml.Name `xml:"arg"`
-	Name      string   `xml:"name,attr"`
-	Type      string   `xml:"type,attr"`
-	Interface string   `xml:"interface,attr"`
-	Enum      string   `xml:"enum,attr"`
-	AllowNull bool     `xml:"allow-null,attr"`
-	Summary   string   `xml:"summary,attr"`
+var maxVersion versionCaps
+
+func (c *versionCaps) String() string {
+	var caps []string
+	if c.all > 0 {
+		caps = append(caps, strconv.Itoa(c.all))
+	}
+	for name, version := range c.iface {
+		caps = append(caps, name+"="+strconv.Itoa(version))
+	}
+	sort.Strings(caps)
+	return strings.Join(caps, ",")
 }
 
-type Event struct {
-	XMLName     xml.Name    `xml:"event"`
-	Name        string      `xml:"name,attr"`
-	Since       int         `xml:"since,attr"`
-	Description Description `xml:"description"`
-	Args        []Arg       `xml:"arg"`
+func (c *versionCaps) Set(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		name, num := "", item
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			name, num = item[:i], item[i+1:]
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil || version < 1 {
+			return fmt.Errorf("bad version in %q", item)
+		}
+		if name == "" {
+			c.all = version
+			continue
+		}
+		if c.iface == nil {
+			c.iface = make(map[string]int)
+		}
+		c.iface[name] = version
+	}
+	return nil
 }
 
-type Enum struct {
-	XMLName     xml.Name    `xml:"enum"`
-	Name        string      `xml:"name,attr"`
-	BitField    bool        `xml:"bitfield,attr"`
-	Description Description `xml:"description"`
-	Entries     []Entry     `xml:"entry"`
+// of returns the version to cap iface at, or 0 for none.
+func (c *versionCaps) of(iface string) int {
+	if version, ok := c.iface[iface]; ok {
+		return version
+	}
+	return c.all
 }
 
-type Entry struct {
-	XMLName xml.Name `xml:"entry"`
-	Name    string   `xml:"name,attr"`
-	Value   string   `xml:"value,attr"`
-	Summary string   `xml:"summary,attr"`
+// versionRanges is a flag giving the range of versions of the messages
+// to generate of every interface, or of the interfaces it names.
+type versionRanges struct {
+	all   [2]int // lowest and highest, 0 for no bound
+	iface map[string][2]int
 }
 
-// go types
-type (
-	GoInterface struct {
-		Name        string
-		WL          string
-		WlInterface Interface
-		Requests    []GoRequest
-		Events      []GoEvent
-		Enums       []GoEnum
-	}
-
-	GoRequest struct {
-		Name           string
-		IfaceName      string
-		Params         string
-		Returns        string
-		Args           string
-		HasNewId       bool
-		NewIdInterface string
-		Order          int
-		Summary        string
-		Description    string
-	}
-
-	GoEvent struct {
-		WL        string
-		Name      string
-		IfaceName string
-		PName     string
-		EName     string
-		Args      []GoArg
-	}
-
-	GoArg struct {
-		Name      string
-		Type      string
-		PName     string
-		BufMethod string
-	}
-
-	GoEnum struct {
-		Name      string
-		IfaceName string
-		Entries   []GoEntry
-	}
-
-	GoEntry struct {
-		Name  string
-		Value string
+var sinceRange versionRanges
+
+func (r *versionRanges) String() string {
+	format := func(lohi [2]int) string {
+		var s [2]string
+		for n, v := range lohi {
+			if v > 0 {
+				s[n] = strconv.Itoa(v)
+			}
+		}
+		return s[0] + "-" + s[1]
 	}
-)
+	var ranges []string
+	if r.all != [2]int{} {
+		ranges = append(ranges, format(r.all))
+	}
+	for name, lohi := range r.iface {
+		ranges = append(ranges, name+"="+format(lohi))
+	}
+	sort.Strings(ranges)
+	return strings.Join(ranges, ",")
+}
 
-var (
-	wlTypes map[string]string = map[string]string{
-		"int":    "int32",
-		"uint":   "uint32",
-		"string": "string",
-		"fd":     "uintptr",
-		"fixed":  "float32",
-		"array":  "[]int32",
+func (r *versionRanges) Set(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		name, rng := "", item
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			name, rng = item[:i], item[i+1:]
+		}
+		bounds := strings.SplitN(rng, "-", 2)
+		if len(bounds) != 2 || bounds[0] == "" && bounds[1] == "" {
+			return fmt.Errorf("bad range in %q", item)
+		}
+		var lohi [2]int
+		for n, b := range bounds {
+			if b == "" {
+				continue
+			}
+			version, err := strconv.Atoi(b)
+			if err != nil || version < 1 {
+				return fmt.Errorf("bad range in %q", item)
+			}
+			lohi[n] = version
+		}
+		if lohi[1] > 0 && lohi[0] > lohi[1] {
+			return fmt.Errorf("bad range in %q", item)
+		}
+		if name == "" {
+			r.all = lohi
+			continue
+		}
+		if r.iface == nil {
+			r.iface = make(map[string][2]int)
+		}
+		r.iface[name] = lohi
 	}
+	return nil
+}
 
-	// sync with event.go
-	bufTypesMap map[string]string = map[string]string{
-		"int32":   "Int32()",
-		"uint32":  "Uint32()",
-		"string":  "String()",
-		"float32": "Float32()",
-		"[]int32": "Array()",
-		"uintptr": "FD()",
+// of returns the range of versions of the messages of iface to keep,
+// 0 meaning no bound.
+func (r *versionRanges) of(iface string) (lo, hi int) {
+	lohi, ok := r.iface[iface]
+	if !ok {
+		lohi = r.all
 	}
+	return lohi[0], lohi[1]
+}
 
-	wlNames    map[string]string
-	fileBuffer = &bytes.Buffer{}
-)
+// sourceData fetches src, or failing that, the first of its mirrors
+// that can be fetched.
+func sourceData(src string, mirrors ...string) io.Reader {
+	data, _ := fetchAny(src, mirrors)
+	return bytes.NewReader(data)
+}
 
-func sourceData() io.Reader {
-	if *source == "" {
+// fetched holds what fetchAny has downloaded, so that a remote source
+// is downloaded once however many packages of a config share it, and
+// whether or not prefetch got to it first.
+var fetched = struct {
+	sync.Mutex
+	bySource map[string]*download
+}{bySource: make(map[string]*download)}
+
+type download struct {
+	once sync.Once
+	data []byte
+	from string
+}
+
+// fetchAny is sourceData, also returning the URL the data came from,
+// after any redirects.
+func fetchAny(src string, mirrors []string) ([]byte, string) {
+	if src == "" {
 		log.Fatal("Must specify a -source")
 	}
+	if !isRemote(src) {
+		return fetchFirst(src, mirrors)
+	}
+	key := strings.Join(append([]string{src}, mirrors...), "\n")
+	fetched.Lock()
+	d := fetched.bySource[key]
+	if d == nil {
+		d = &download{}
+		fetched.bySource[key] = d
+	}
+	fetched.Unlock()
+	d.once.Do(func() {
+		d.data, d.from = fetchFirst(src, mirrors)
+	})
+	return d.data, d.from
+}
+
+// fetchFirst fetches src, or failing that the first of its mirrors
+// that can be fetched.
+func fetchFirst(src string, mirrors []string) ([]byte, string) {
+
+	var err error
+	for i, url := range append([]string{src}, mirrors...) {
+		var data []byte
+		var from string
+		data, from, err = fetch(url)
+		if err == nil {
+			if i > 0 && !*quiet {
+				log.Printf("%s: fetched from mirror %s", src, url)
+			}
+			return data, from
+		}
+		if i < len(mirrors) && !*quiet {
+			log.Printf("%s; trying %s", err, mirrors[i])
+		}
+	}
+	log.Fatal(err)
+	return nil, ""
+}
 
-	if strings.HasPrefix(*source, "http:") || strings.HasPrefix(*source, "https:") {
-		resp, err := http.Get(*source)
+// fetch reads a local file or http(s) URL, giving up on a URL after
+// -fetch-timeout.
+func fetch(src string) ([]byte, string, error) {
+	if !isRemote(src) {
+		file, err := filePath(src)
 		if err != nil {
-			log.Fatal(err)
+			return nil, "", err
 		}
-		return resp.Body
-	} else {
-		f, err := os.Open(*source)
+		data, err := ioutil.ReadFile(file)
+		return data, src, err
+	}
+	if strings.HasPrefix(src, "gitlab:") {
+		api, err := gitlabURL(src)
 		if err != nil {
-			log.Fatal(err)
+			return nil, "", err
 		}
-		return f
+		src = api
 	}
+	client := &http.Client{Timeout: *fetchTimeout}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, "", fmt.Errorf("%s: %s", src, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %s", src, err)
+	}
+	return data, resp.Request.URL.String(), nil
 }
 
-var wlPrefix string
+// filePath returns the file a local source names: a path, a file: URL
+// like file:///usr/share/wayland/wayland.xml, or a pkg-config: source.
+func filePath(src string) (string, error) {
+	if strings.HasPrefix(src, "pkg-config:") {
+		return pkgConfigPath(src)
+	}
+	if !strings.HasPrefix(src, "file:") {
+		return src, nil
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("%s is on another host", src)
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return "", fmt.Errorf("%s is not an absolute file: URL", src)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+func isRemote(src string) bool {
+	return strings.HasPrefix(src, "http:") || strings.HasPrefix(src, "https:") || strings.HasPrefix(src, "gitlab:")
+}
+
+// readProtocol fetches and decodes the protocol (or IR) at src, for the
+// subcommands that work on the model rather than generating code.
+func readProtocol(src string) *Protocol {
+	data, err := ioutil.ReadAll(sourceData(src))
+	if err != nil {
+		log.Fatal(err)
+	}
+	prot, err := protocol.Decode(src, data)
+	if err != nil {
+		log.Fatalf("%s: %s", src, err)
+	}
+	rememberProtocol(src, prot)
+	return prot
+}
 
 func main() {
 	log.SetFlags(0)
 	flag.Parse()
-
-	dest := *output
-	if dest == "" {
-		log.Fatal("Must specify -output")
+	if *diagFormat != "text" && *diagFormat != "json" {
+		log.Fatalf("-diagnostics-format: unknown format %q (want text or json)", *diagFormat)
 	}
+	defer startProfiling()()
 
-	var protocol Protocol
+	switch flag.Arg(0) {
+	case "lint":
+		runLint(flag.Args()[1:])
+		return
+	case "verify-c":
+		runVerifyC(flag.Args()[1:])
+		return
+	case "docs":
+		runDocs(flag.Args()[1:])
+		return
+	case "ir":
+		runIR(flag.Args()[1:])
+		return
+	case "config":
+		runConfig(flag.Args()[1:])
+		return
+	case "init":
+		runInit(flag.Args()[1:])
+		return
+	case "lock", "update":
+		runLock(flag.Arg(0), flag.Args()[1:])
+		return
+	case "changelog":
+		runChangelog(flag.Args()[1:])
+		return
+	}
 
-	file := sourceData()
+	if *config != "" {
+		if *source != "" || *output != "" || *annotations != "" {
+			log.Fatal("-source, -output and -annotations come from the -config file")
+		}
+		runBatch(*config)
+		return
+	}
 
-	err := decodeWlXML(file, &protocol)
-	if err != nil {
-		log.Fatal(err)
+	if *umbrellaDir != "" && !isCheckout(*source) {
+		log.Fatal("-umbrella needs several packages, from -config or a checkout")
+	}
+	if isCheckout(*source) {
+		runCheckout(*source)
+		return
 	}
 
-	wlNames = make(map[string]string)
-	wlPrefix = ""
+	j := &job{
+		Source:   *source,
+		Output:   *output,
+		Package:  *pkgName,
+		Unstable: *unstable,
+		Manifest: *manifest,
+		Module:   *module,
+		Mirrors:  mirrors,
 
-	if protocol.Name != "wayland" {
-		for _, inherit := range inheritedNames {
-			wlNames[inherit] = "wl." + CamelCase(inherit)
-		}
+		Annotations: *annotations,
 	}
-	if *pkgName != "wl" {
-		wlPrefix = "wl."
-		trimPrefix = *pkgName + "_"
+	if (j.Output == "") == (*outputTemplate == "") {
+		log.Fatal("Must specify one of -output and -output-template")
 	}
-	if *unstable != "" {
-		ifTrimSuffix = "_" + *unstable
+	j.load()
+	if j.Output == "" {
+		j.Output = j.templateOutput()
 	}
-
-	// required for request and event parameters
-	for _, iface := range protocol.Interfaces {
-		caseAndRegister(stripUnstable(iface.Name))
+	if *skipUnchanged && skip([]*job{j}) {
+		return
 	}
 
-	fmt.Fprintf(fileBuffer, "// package %s acts as a client for the %s wayland protocol.\n\n",
-		*pkgName,
-		protocol.Name)
-
-	fmt.Fprintf(fileBuffer, "// generated by wl-scanner\n// https://github.com/dkolbly/wl-scanner\n")
-	fmt.Fprintf(fileBuffer, "// from: %s\n", *source)
-	t := time.Now()
-	fmt.Fprintf(fileBuffer, "// on %s\n", t.Format("2006-01-02 15:04:05 -0700"))
-	fmt.Fprintf(fileBuffer, "package %s\n", *pkgName)
-	fmt.Fprintf(fileBuffer, "import (\n")
-	fmt.Fprintf(fileBuffer, "     \"sync\"\n")
-	if *pkgName != "wl" {
-		fmt.Fprintf(fileBuffer, "     \"github.com/dkolbly/wl\"\n")
+	if reportErrors(preflight([]sourceProtocol{j.input(baseOptions())})) > 0 {
+		log.Fatalf("%s cannot be generated", j.Source)
+	}
+
+	generateAll([]*job{j}, nil)
+
+	if *checkRepro {
+		checkReproducible(j.Output)
+	}
+}
+
+// A job is one protocol to generate a package from.
+type job struct {
+	Source   string   `json:"source"`
+	Output   string   `json:"output"`
+	Package  string   `json:"pkg"`
+	Unstable string   `json:"unstable,omitempty"`
+	Import   string   `json:"import,omitempty"`
+	Manifest string   `json:"manifest,omitempty"`
+	Module   string   `json:"module,omitempty"`
+	Mirrors  []string `json:"mirrors,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`  // interfaces and interface.messages to leave out
+	Imports  []string `json:"imports,omitempty"`  // added to the generated file's
+	Append   []string `json:"append,omitempty"`   // files of Go code to append to it
+	Snippets string   `json:"snippets,omitempty"` // directory of templates to add after each interface's code
+
+	Annotations string `json:"annotations,omitempty"` // file annotating the protocol
+
+	pin       *pin              // from the config's lock file
+	snippet   string            // the Append files
+	snippets  map[string]string // the Snippets templates, by interface
+	inputs    string            // hash of the inputs, for -skip-unchanged
+	sourceSum string            // SHA-256 of the source, for -sidecar
+	sourceURL string            // it was fetched from, after mirrors and redirects
+	data      []byte
+	prot      *Protocol
+	files     []generator.File
+	api       api // of the generated file, and of the one it replaces, for -changelog
+	oldAPI    api
+	staged    []stagedFile
+	written   []stagedFile // once committed
+	elapsed   time.Duration
+	warnings  []Diagnostic
+	err       error
+}
+
+// load reads, checks and decodes the job's source.
+func (j *job) load() {
+	if j.Module != "" && j.Package != "wl" && *runtimeVersion == "" {
+		log.Fatalf("-runtime-version is needed for the go.mod of %s", j.Module)
+	}
+	var data []byte
+	if j.pin != nil {
+		data, j.sourceURL = j.pin.fetch(j.Mirrors)
+	} else {
+		data, j.sourceURL = fetchAny(j.Source, j.Mirrors)
 	}
-	fmt.Fprintf(fileBuffer, ")\n")
+	j.data = data
+	j.sourceSum = sha256Hex(data)
 
-	for _, iface := range protocol.Interfaces {
-		goIface := GoInterface{
-			Name:        wlNames[stripUnstable(iface.Name)],
-			WlInterface: iface,
-			WL:          wlPrefix,
+	if protocol.IsIR(j.Source, data) && (*validate || *strict || *vendorXML) {
+		log.Fatal("-validate, -strict and -vendor-xml only apply to XML sources")
+	}
+	if *validate {
+		if reportErrors(validateDTD(j.Source, data)) > 0 {
+			log.Fatalf("%s does not conform to the wayland DTD", j.Source)
+		}
+	}
+	if *strict {
+		if reportErrors(checkStrict(j.Source, data)) > 0 {
+			log.Fatalf("%s uses features not supported by wl-scanner", j.Source)
 		}
-
-		goIface.ProcessEvents()
-		goIface.Constructor()
-		goIface.ProcessRequests()
-		goIface.ProcessEnums()
 	}
 
-	out, err := os.Create(dest)
+	var err error
+	j.prot, err = protocol.Decode(j.Source, data)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer out.Close()
-
-	fileBuffer.WriteTo(out)
-
-	fmtFile()
-}
-
-func decodeWlXML(file io.Reader, prot *Protocol) error {
-	err := xml.NewDecoder(file).Decode(&prot)
-	if err != nil {
-		return fmt.Errorf("Cannot decode wayland.xml: %s", err)
+	if reportErrors(versionDiags(j.Source, j.prot)) > 0 {
+		log.Fatalf("%s has interfaces without a version", j.Source)
 	}
-	return nil
-}
-
-// register names to map
-func caseAndRegister(wlName string) string {
-	var orj string = wlName
-	wlName = CamelCase(wlName)
-	wlNames[orj] = wlName
-	return wlName
-}
+	rememberProtocol(j.Source, j.prot)
 
-func executeTemplate(name string, tpl string, data interface{}) {
-	tmpl := template.Must(template.New(name).Parse(tpl))
-	err := tmpl.Execute(fileBuffer, data)
-	if err != nil {
-		log.Fatal(err)
+	if err := protocol.Trim(j.prot, maxVersion.of); err != nil {
+		log.Fatalf("%s: %s", j.Source, err)
 	}
-}
-
-func (i *GoInterface) Constructor() {
-	executeTemplate("InterfaceTypeTemplate", ifaceTypeTemplate, i)
-	executeTemplate("InterfaceConstructorTemplate", ifaceConstructorTemplate, i)
-}
-
-func (i *GoInterface) ProcessRequests() {
-	for order, wlReq := range i.WlInterface.Requests {
-		var (
-			returns         []string
-			params          []string
-			sendRequestArgs []string // for sendRequest
-		)
-
-		req := GoRequest{
-			Name:        CamelCase(wlReq.Name),
-			IfaceName:   stripUnstable(i.Name),
-			Order:       order,
-			Summary:     wlReq.Description.Summary,
-			Description: reflow(wlReq.Description.Text),
-		}
-
-		for _, arg := range wlReq.Args {
-			if arg.Type == "new_id" {
-				if arg.Interface != "" {
-					newIdIface := wlNames[stripUnstable(arg.Interface)]
-					req.NewIdInterface = newIdIface
-					sendRequestArgs = append(params, wlPrefix+"Proxy(ret)")
-					req.HasNewId = true
-
-					returns = append(returns, "*"+newIdIface)
-				} else { //special for registry.Bind
-					sendRequestArgs = append(sendRequestArgs, "iface")
-					sendRequestArgs = append(sendRequestArgs, "version")
-					sendRequestArgs = append(sendRequestArgs, arg.Name)
-
-					params = append(params, "iface string")
-					params = append(params, "version uint32")
-					params = append(params, fmt.Sprintf("%s %sProxy", arg.Name, wlPrefix))
-				}
-			} else if arg.Type == "object" && arg.Interface != "" {
-				paramTypeName := wlNames[stripUnstable(arg.Interface)]
-				params = append(params, fmt.Sprintf("%s *%s", arg.Name, paramTypeName))
-				sendRequestArgs = append(sendRequestArgs, arg.Name)
-				/*} else if arg.Type == "uint" && arg.Enum != "" {
-					params = append(params, fmt.Sprintf("%s %s", arg.Name, enumArgName(ifaceName, arg.Enum)))
-				}*/
-			} else {
-				sendRequestArgs = append(sendRequestArgs, arg.Name)
-				params = append(params, fmt.Sprintf("%s %s", arg.Name, wlTypes[arg.Type]))
-			}
+	protocol.TrimSince(j.prot, sinceRange.of)
+	if err := protocol.Exclude(j.prot, j.Exclude); err != nil {
+		log.Fatalf("%s: %s", j.Source, err)
+	}
+	if j.Annotations != "" {
+		text, err := ioutil.ReadFile(j.Annotations)
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		req.Params = strings.Join(params, ",")
-
-		if len(sendRequestArgs) > 0 {
-			req.Args = "," + strings.Join(sendRequestArgs, ",")
+		ann, err := protocol.ReadAnnotations(j.Annotations, text)
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		if len(returns) > 0 { // ( ret , error )
-			req.Returns = fmt.Sprintf("(%s , error)", strings.Join(returns, ","))
-		} else { // returns only error
-			req.Returns = "error"
+		if err := protocol.Annotate(j.prot, ann); err != nil {
+			log.Fatal(err)
 		}
-
-		executeTemplate("RequestTemplate", requestTemplate, req)
-		i.Requests = append(i.Requests, req)
 	}
-}
 
-func (i *GoInterface) ProcessEvents() {
-	// Event struct types
-	for _, wlEv := range i.WlInterface.Events {
-		ev := GoEvent{
-			Name:      CamelCase(wlEv.Name),
-			PName:     snakeCase(wlEv.Name),
-			IfaceName: i.Name,
-			WL:        wlPrefix,
+	var snippets []string
+	for _, file := range j.Append {
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
 		}
-		ev.EName = i.Name + ev.Name
-
-		for _, arg := range wlEv.Args {
-			goarg := GoArg{
-				Name:  CamelCase(arg.Name),
-				PName: snakeCase(arg.Name),
-			}
-			if t, ok := wlTypes[arg.Type]; ok { // if basic type
-				bufMethod, ok := bufTypesMap[t]
-				if !ok {
-					log.Printf("%s not registered", t)
-				} else {
-					goarg.BufMethod = bufMethod
-				}
-				/*
-					if arg.Type == "uint" && arg.Enum != "" { // enum type
-						enumTypeName := ifaceName + CamelCase(arg.Enum)
-						fmt.Fprintf(&eventBuffer, "%s %s\n", CamelCase(arg.Name), enumTypeName)
-					} else {
-						fmt.Fprintf(&eventBuffer, "%s %s\n", CamelCase(arg.Name), t)
-					}*/
-				goarg.Type = t
-			} else { // interface type
-				if (arg.Type == "object" || arg.Type == "new_id") && arg.Interface != "" {
-					t = "*" + wlNames[stripUnstable(arg.Interface)]
-					goarg.BufMethod = fmt.Sprintf("%sProxy(p.Context()).(%s)", wlPrefix, t)
-				} else {
-					t = wlPrefix + "Proxy"
-					goarg.BufMethod = wlPrefix + "Proxy(p.Context())"
-				}
-				goarg.Type = t
-			}
-
-			ev.Args = append(ev.Args, goarg)
+		snippets = append(snippets, fmt.Sprintf("// from %s\n%s", filepath.Base(file), code))
+	}
+	j.snippet = strings.Join(snippets, "\n")
+	if j.Snippets != "" {
+		var err error
+		if j.snippets, err = readSnippets(j.Snippets); err != nil {
+			log.Fatal(err)
 		}
-
-		executeTemplate("EventTemplate", eventTemplate, ev)
-		executeTemplate("AddRemoveHandlerTemplate", ifaceAddRemoveHandlerTemplate, ev)
-
-		i.Events = append(i.Events, ev)
 	}
 
-	if len(i.Events) > 0 {
-		executeTemplate("InterfaceDispatchTemplate", ifaceDispatchTemplate, i)
+	if (*license != "" || *copyrightHeader) && j.prot.Copyright == "" {
+		warnf("no-copyright", j.Source, j.prot.Line, "protocol %s has no copyright element to copy", j.prot.Name)
 	}
 }
 
-func (i *GoInterface) ProcessEnums() {
-	// Enums - Constants
-	for _, wlEnum := range i.WlInterface.Enums {
-		goEnum := GoEnum{
-			Name:      CamelCase(wlEnum.Name),
-			IfaceName: i.Name,
-		}
-
-		for _, wlEntry := range wlEnum.Entries {
-			goEntry := GoEntry{
-				Name:  CamelCase(wlEntry.Name),
-				Value: wlEntry.Value,
-			}
-			goEnum.Entries = append(goEnum.Entries, goEntry)
-		}
-
-		executeTemplate("InterfaceEnumsTemplate", ifaceEnums, goEnum)
+// readSnippets reads the interface snippets in dir, the files named
+// after an interface with .tmpl added, as in wl_surface.tmpl.  Other
+// files are left alone.
+func readSnippets(dir string) (map[string]string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
 	}
-}
-
-/*
-func enumArgName(ifaceName, enumName string) string {
-	if strings.Index(enumName, ".") == -1 {
-		return ifaceName + CamelCase(enumName)
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
 	}
-
-	parts := strings.Split(enumName, ".")
-	if len(parts) != 2 {
-		log.Fatalf("enum args must be \"interface.enum\" format: we get %s",enumName)
+	snippets := make(map[string]string)
+	for _, file := range files {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+		snippets[name] = string(text)
 	}
-	return CamelCase(parts[0]) + CamelCase(parts[1])
+	return snippets, nil
 }
-*/
-
-var trimPrefix = "wl_"
-var ifTrimSuffix = ""
-
-func CamelCase(wlName string) string {
-	wlName = strings.TrimPrefix(wlName, trimPrefix)
-
-	// replace all "_" chars to " " chars
-	wlName = strings.Replace(wlName, "_", " ", -1)
-
-	// Capitalize first chars
-	wlName = strings.Title(wlName)
-
-	// remove all spaces
-	wlName = strings.Replace(wlName, " ", "", -1)
 
-	return wlName
+// outputName is what -output-template can use.
+type outputName struct {
+	Protocol string // as the XML names it, e.g. xdg_shell
+	Package  string
 }
 
-func snakeCase(wlName string) string {
-	if strings.HasPrefix(wlName, "wl_") {
-		wlName = strings.TrimPrefix(wlName, "wl_")
+// templateOutput names the job's output with -output-template, once
+// its protocol is loaded.
+func (j *job) templateOutput() string {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(*outputTemplate)
+	if err != nil {
+		log.Fatalf("-output-template: %s", err)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, outputName{j.prot.Name, j.Package}); err != nil {
+		log.Fatalf("-output-template: %s", err)
+	}
+	if buf.Len() == 0 {
+		log.Fatalf("-output-template names no file for %s", j.Source)
+	}
+	return buf.String()
+}
+
+// skip reports whether the output of jobs is up to date with their
+// inputs.  If it is not, the jobs are told the hash to record.
+func skip(jobs []*job) bool {
+	sum := inputsHash(jobs)
+	if unchanged(jobs, sum) {
+		return true
+	}
+	for _, j := range jobs {
+		j.inputs = sum
+	}
+	return false
+}
+
+// input returns the job's protocol with the options it is generated
+// with, base being those of the command line.
+func (j *job) input(base generator.Options) sourceProtocol {
+	return sourceProtocol{j.Source, j.prot, j.options(base, nil)}
+}
+
+// baseOptions are the generator options the command line flags give,
+// shared by every job.
+func baseOptions() generator.Options {
+	opts := generator.Options{
+		Command:          commandLine(),
+		GoVersion:        *goVersion,
+		Metrics:          *metrics,
+		Middleware:       *middleware,
+		DispatchTable:    *dispatchTable,
+		StrictDecode:     *strictDecode,
+		ValidateRequests: *validateRequests,
+		Binders:          *binders,
+		EnumNames:        *enumNames,
+		MessageNames:     *messageNames,
+		Descriptor:       *descriptor,
+		Wait:             *wait,
+		Filters:          *filters,
+		Clone:            *clone,
+		JSON:             *jsonEvents,
+		Queue:            *queue,
+		GuardDestroyed:   *guardDestroyed,
+		TrackObjects:     *trackObjects,
+		Release:          *release,
+		Metadata:         *metadata,
+		NoDocs:           *noDocs,
+		Stats:            *stats,
+		EmbedXML:         *embedXML,
+		DocGo:            *docGo,
+		WireTables:       *wireTables,
+		License:          *license,
+		CopyrightHeader:  *copyrightHeader,
+		SPDX:             *spdx,
+		Reproducible:     *reproducible,
+		RuntimeVersion:   *runtimeVersion,
+	}
+	if *header != "" {
+		tpl, err := ioutil.ReadFile(*header)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Header = string(tpl)
 	}
 
-	// replace all "_" chars to " " chars
-	wlName = strings.Replace(wlName, "_", " ", -1)
-	parts := strings.Split(wlName, " ")
-	for i, p := range parts {
-		if i == 0 {
-			continue
-		}
-		parts[i] = strings.Title(p)
+	opts.Emitters = append(opts.Emitters, artifactEmitters()...)
+	if *vendorXML {
+		opts.Emitters = append(opts.Emitters, generator.EmitterFunc(vendorFile))
 	}
 
-	return strings.Join(parts, "")
+	for _, file := range templates {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+		e, err := generator.TemplateEmitter(name, string(text))
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Emitters = append(opts.Emitters, e)
+	}
+	return opts
 }
 
-func fmtFile() {
-	goex, err := exec.LookPath("go")
-	if err != nil {
-		log.Printf("go executable cannot found run \"go fmt %s\" yourself: %s", *output, err)
+// generate runs the generator for the job.  names, if not nil, holds
+// the other packages generated in the same run.
+func (j *job) generate(base generator.Options, names *generator.NameTable) {
+	opts := j.options(base, names)
+	if emitKinds()["client"] {
+		j.files, j.err = generator.Generate(j.prot, opts)
 		return
 	}
-
-	cmd := exec.Command(goex, "fmt", *output)
-	er2 := cmd.Run()
-	if er2 != nil {
-		log.Fatalf("Cannot run cmd: %s", er2)
+	// The other extras, from doc.go to go.mod, go with the client
+	// code, so without it only what -emit names is written.
+	m := &generator.Model{Protocol: j.prot, Options: opts}
+	j.files = nil
+	for _, e := range artifactEmitters() {
+		files, err := e.Emit(m)
+		if err != nil {
+			j.files, j.err = nil, err
+			return
+		}
+		j.files = append(j.files, files...)
+	}
+}
+
+// options returns the generator options for the job, adding its own to
+// base.
+func (j *job) options(base generator.Options, names *generator.NameTable) generator.Options {
+	opts := base
+	opts.Package = j.Package
+	opts.Unstable = j.Unstable
+	opts.Output = filepath.Base(j.Output)
+	opts.Source = j.Source
+	opts.SourceData = j.data
+	opts.Manifest = j.Manifest != ""
+	opts.Module = j.Module
+	opts.InputHash = j.inputs
+	opts.Imports = j.Imports
+	opts.Snippet = j.snippet
+	opts.InterfaceSnippets = j.snippets
+	opts.Names = names
+	opts.WarnRule = func(rule string, line int, msg string) {
+		j.warnings = append(j.warnings, Diagnostic{
+			File:     j.Source,
+			Line:     line,
+			Severity: severityWarning,
+			Rule:     rule,
+			Message:  msg,
+		})
+	}
+	return opts
+}
+
+// emitKinds returns the set of artifacts -emit asks for.
+func emitKinds() map[string]bool {
+	kinds := make(map[string]bool)
+	for _, kind := range strings.Split(*emit, ",") {
+		switch kind {
+		case "client", "docs", "ir":
+			kinds[kind] = true
+		case "server":
+			log.Fatal("-emit server: wl-scanner only generates client code")
+		default:
+			log.Fatalf("-emit: unknown artifact %q (want client, docs or ir)", kind)
+		}
 	}
-}
+	return kinds
+}
+
+// artifactEmitters returns the emitters of what -emit asks for besides
+// the client code.
+func artifactEmitters() []generator.Emitter {
+	var es []generator.Emitter
+	kinds := emitKinds()
+	if kinds["docs"] {
+		es = append(es, generator.EmitterFunc(docsFile))
+	}
+	if kinds["ir"] {
+		es = append(es, generator.EmitterFunc(irFile))
+	}
+	return es
+}
+
+// generateAll generates the jobs, -jobs of them at a time, staging
+// each one's files as soon as they are made so that only the packages
+// in progress are held in memory, and puts them all in place once
+// nothing stands in the way.  Warnings and errors are reported in job
+// order, whatever order the jobs finish in.
+func generateAll(jobs []*job, names *generator.NameTable) {
+	if *parallel < 1 {
+		log.Fatal("-jobs must be at least 1")
+	}
+	base := baseOptions()
+	staged := make([]error, len(jobs))
+	prog := newProgress(*progressFormat, len(jobs))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *parallel && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := time.Now()
+				jobs[i].generate(base, names)
+				jobs[i].noteChanges()
+				staged[i] = jobs[i].stage()
+				jobs[i].elapsed = time.Since(start)
+				prog.finished(jobs[i])
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	prog.summary(jobs)
 
-// templates
-var (
-	ifaceTypeTemplate = `
-type {{.Name}} struct {
-	{{.WL}}BaseProxy
-	{{- if gt (len .Events) 0 }}
-	mu sync.RWMutex
-	{{- end}}
+	for i, j := range jobs {
+		warnings = append(warnings, j.warnings...)
+		if staged[i] != nil {
+			discard(jobs)
+			log.Fatal(staged[i])
+		}
+	}
 
-	{{- range .Events}}
-	{{.PName}}Handlers []{{.EName}}Handler
-	{{- end}}
-}
-`
-	ifaceConstructorTemplate = `
-func New{{.Name}}(ctx *{{.WL}}Context) *{{.Name}} {
-	ret := new({{.Name}})
-	ctx.Register(ret)
-	return ret
-}
-`
-	ifaceAddRemoveHandlerTemplate = `
-func (p *{{.IfaceName}}) Add{{.Name}}Handler(h {{.EName}}Handler) {
-	if h != nil {
-		p.mu.Lock()
-		p.{{.PName}}Handlers = append(p.{{.PName}}Handlers , h)
-		p.mu.Unlock()
+	all := jobs
+	if *umbrellaDir != "" {
+		u := umbrellaJob(jobs)
+		all = append(all[:len(all):len(all)], u)
+		if err := u.stage(); err != nil {
+			discard(all)
+			log.Fatal(err)
+		}
 	}
-}
 
-func (p *{{.IfaceName}}) Remove{{.Name}}Handler(h {{.EName}}Handler) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	summarizeWarnings()
+	if *werror && len(warnings) > 0 {
+		discard(all)
+		log.Fatal("warnings treated as errors (-Werror)")
+	}
 
-	for i , e := range p.{{.PName}}Handlers {
-		if e == h {
-			p.{{.PName}}Handlers = append(p.{{.PName}}Handlers[:i] , p.{{.PName}}Handlers[i+1:]...)
-			break
+	for _, j := range all {
+		j.commit()
+	}
+	if *sidecarPath != "" {
+		writeSidecar(*sidecarPath, jobs)
+	}
+	if *changelog != "" {
+		writeChangelogFile(*changelog, jobs)
+	}
+	for _, j := range jobs {
+		if j.err != nil {
+			log.Fatal(j.err)
 		}
 	}
 }
-`
-
-	requestTemplate = `
-// {{.Name}} will {{.Summary}}.
-//
-{{.Description}}func (p *{{.IfaceName}}) {{.Name}}({{.Params}}) {{.Returns}} {
-	{{- if .HasNewId}}
-	ret := New{{.NewIdInterface}}(p.Context())
-	return ret , p.Context().SendRequest(p,{{.Order}}{{.Args}})
-	{{- else}}
-	return p.Context().SendRequest(p,{{.Order}}{{.Args}})
-	{{- end}}
-}
-`
 
-	eventTemplate = `
-type {{.IfaceName}}{{.Name}}Event struct {
-	{{- range .Args }}
-	{{.Name}} {{.Type}}
-	{{- end }}
+// A stagedFile is a generated file written under a temporary name next
+// to where it belongs.
+type stagedFile struct {
+	tmp, dest string
+	sum       string // SHA-256 of the content, for -sidecar
 }
 
-type {{.IfaceName}}{{.Name}}Handler interface {
-    Handle{{.EName}}({{.EName}}Event)
+// stage writes the generated files under temporary names and lets go
+// of them.  Go code that failed to format is still staged, to be put
+// in place before giving up.  A go.mod is only written into a
+// directory that has none, so one that has been edited since is not
+// lost.
+func (j *job) stage() error {
+	if j.files == nil {
+		return j.err
+	}
+	for _, f := range j.files {
+		file := filepath.Join(filepath.Dir(j.Output), f.Name)
+		if f.Name == generator.ManifestFile {
+			file = j.Manifest
+		}
+		if f.Name == generator.GoModFile {
+			if _, err := os.Stat(file); err == nil {
+				continue
+			}
+		}
+		// -output-template may name a directory that is not there yet
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			return err
+		}
+		tmp := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+		if err := ioutil.WriteFile(tmp, f.Data, 0666); err != nil {
+			return err
+		}
+		j.staged = append(j.staged, stagedFile{tmp, file, sha256Hex(f.Data)})
+	}
+	j.files, j.data = nil, nil
+	return nil
 }
-`
 
-	ifaceDispatchTemplate = `
-func (p *{{.Name}}) Dispatch(event *{{.WL}}Event) {
-	{{- $ifaceName := .Name }}
-	switch event.Opcode {
-	{{- range $i , $event := .Events }}
-	case {{$i}}:
-		if len(p.{{.PName}}Handlers) > 0 {
-			ev := {{$ifaceName}}{{.Name}}Event{}
-			{{- range $event.Args}}
-			ev.{{.Name}} = event.{{.BufMethod}}
-			{{- end}}
-			p.mu.RLock()
-			for _, h := range p.{{.PName}}Handlers {
-				h.Handle{{.EName}}(ev)
-			}
-			p.mu.RUnlock()
+// commit moves the staged files into place.
+func (j *job) commit() {
+	for _, f := range j.staged {
+		if err := os.Rename(f.tmp, f.dest); err != nil {
+			log.Fatal(err)
 		}
-	{{- end}}
 	}
+	j.written, j.staged = j.staged, nil
 }
-`
-	ifaceEnums = `
-const (
-	{{- $ifaceName := .IfaceName }}
-	{{- $enumName := .Name }}
-	{{- range .Entries}}
-	{{$ifaceName}}{{$enumName}}{{.Name}} = {{.Value}}
-	{{- end}}
-)
-`
-)
 
-var inheritedNames = []string{
-	"wl_display",
-	"wl_registry",
-	"wl_callback",
-	"wl_compositor",
-	"wl_shm_pool",
-	"wl_shm",
-	"wl_buffer",
-	"wl_data_offer",
-	"wl_data_source",
-	"wl_data_device",
-	"wl_data_device_manager",
-	"wl_shell",
-	"wl_shell_surface",
-	"wl_surface",
-	"wl_seat",
-	"wl_pointer",
-	"wl_keyboard",
-	"wl_touch",
-	"wl_output",
-	"wl_region",
-	"wl_subcompositor",
-	"wl_subsurface",
-}
-
-func reflow(text string) string {
-	ret := ""
-	for _, line := range strings.Split(text, "\n") {
-		ret = ret + "// " + strings.TrimSpace(line) + "\n"
-	}
-	return ret
-}
-
-func stripUnstable(ifname string) string {
-	return strings.TrimSuffix(ifname, ifTrimSuffix)
+// discard removes whatever the jobs have staged.
+func discard(jobs []*job) {
+	for _, j := range jobs {
+		for _, f := range j.staged {
+			os.Remove(f.tmp)
+		}
+		j.staged = nil
+	}
 }